@@ -0,0 +1,157 @@
+package cryptsetup
+
+/*
+#cgo pkg-config: libcryptsetup
+#include <libcryptsetup.h>
+
+// BITLK support was introduced in libcryptsetup 2.3, along with signed Verity root hashes,
+// so crypt_activate_by_signed_key is declared weak and checked at runtime to detect it.
+int crypt_activate_by_signed_key(struct crypt_device *cd, const char *name,
+	const char *volume_key, size_t volume_key_size,
+	const char *signature, size_t signature_size,
+	uint32_t flags) __attribute__((weak));
+
+static int bitlk_supported(void) {
+	return crypt_activate_by_signed_key != NULL;
+}
+*/
+import "C"
+import (
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// BITLK is the struct used to manipulate BitLocker devices.
+// These devices can only be loaded, and once loaded they're activated using ActivateByPassphrase(),
+// with either a user passphrase or a recovery password.
+// Requires libcryptsetup 2.3 or newer.
+type BITLK struct{}
+
+// Name returns the BITLK device type name as a string.
+func (bitlk BITLK) Name() string {
+	return "BITLK"
+}
+
+// Unmanaged is used to specialize BITLK.
+// BITLK devices don't take any type-specific parameters.
+func (bitlk BITLK) Unmanaged() (unsafe.Pointer, func()) {
+	return nil, func() {}
+}
+
+// bitlkSupported reports whether the loaded libcryptsetup supports BITLK devices.
+func bitlkSupported() bool {
+	return C.bitlk_supported() != 0
+}
+
+// BITLKProtection describes how a BitLocker volume master key is protected.
+type BITLKProtection string
+
+const (
+	BITLKProtectionClearKey           BITLKProtection = "clear key"
+	BITLKProtectionTPM                BITLKProtection = "TPM"
+	BITLKProtectionStartupKey         BITLKProtection = "startup key"
+	BITLKProtectionTPMAndPIN          BITLKProtection = "TPM and PIN"
+	BITLKProtectionRecoveryPassphrase BITLKProtection = "recovery passphrase"
+	BITLKProtectionPassphrase         BITLKProtection = "passphrase"
+	BITLKProtectionSmartCard          BITLKProtection = "smart card"
+	BITLKProtectionUnknown            BITLKProtection = "unknown"
+)
+
+// BITLKProtector is a BitLocker volume master key protector.
+type BITLKProtector struct {
+	GUID       string
+	Name       string
+	Protection BITLKProtection
+}
+
+// BITLKInfo holds the metadata of a loaded BitLocker device.
+// VolumeKeySize is expressed in bytes.
+type BITLKInfo struct {
+	Version       uint32
+	GUID          string
+	SectorSize    uint32
+	VolumeSize    uint64
+	Created       string
+	Description   string
+	Cipher        string
+	CipherMode    string
+	VolumeKeySize int
+	Protectors    []BITLKProtector
+}
+
+// parseBITLKDump builds a BITLKInfo out of the output of crypt_dump for a BITLK device.
+func parseBITLKDump(dump string) BITLKInfo {
+	info := BITLKInfo{Protectors: make([]BITLKProtector, 0)}
+	var protector *BITLKProtector
+
+	for _, line := range strings.Split(dump, "\n") {
+		if line == "" {
+			continue
+		}
+
+		if line == "Metadata segments:" {
+			break
+		}
+
+		fields := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		key, value := fields[0], strings.TrimSpace(fields[1])
+
+		if _, err := strconv.Atoi(key); err == nil {
+			protector = nil
+			if value == "VMK" {
+				info.Protectors = append(info.Protectors, BITLKProtector{})
+				protector = &info.Protectors[len(info.Protectors)-1]
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "\t") {
+			if protector == nil {
+				continue
+			}
+
+			switch key {
+			case "GUID":
+				protector.GUID = value
+			case "Name":
+				protector.Name = value
+			case "Protection":
+				protector.Protection = BITLKProtectionUnknown
+				if strings.HasPrefix(value, "VMK protected with ") {
+					protector.Protection = BITLKProtection(strings.TrimPrefix(value, "VMK protected with "))
+				}
+			}
+			continue
+		}
+
+		switch key {
+		case "Version":
+			version, _ := strconv.ParseUint(value, 10, 32)
+			info.Version = uint32(version)
+		case "GUID":
+			info.GUID = value
+		case "Sector size":
+			sectorSize, _ := strconv.ParseUint(strings.TrimSuffix(value, " [bytes]"), 10, 32)
+			info.SectorSize = uint32(sectorSize)
+		case "Volume size":
+			info.VolumeSize, _ = strconv.ParseUint(strings.TrimSuffix(value, " [bytes]"), 10, 64)
+		case "Created":
+			info.Created = value
+		case "Description":
+			info.Description = value
+		case "Cipher name":
+			info.Cipher = value
+		case "Cipher mode":
+			info.CipherMode = value
+		case "Cipher key":
+			keyBits, _ := strconv.Atoi(strings.TrimSuffix(value, " bits"))
+			info.VolumeKeySize = keyBits / 8
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,376 @@
+package cryptsetup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const bitlkDump string = `Info for BITLK device testDevice.
+Version:      	2
+GUID:         	4b5a0df3-8b7b-4cf4-9a3c-4b3cc6e1c3a5
+Sector size:  	512 [bytes]
+Volume size:  	104857600 [bytes]
+Created:      	Wed Oct 19 10:20:30 2026
+Description:  	DESKTOP-TEST Data 19/10/2026
+Cipher name:  	aes
+Cipher mode:  	xts-plain64
+Cipher key:   	128 bits
+
+Keyslots:
+ 0: VMK
+	GUID:       	9e3a2a6b-4c3a-4f0e-9d38-2a8f2d1c3b4e
+	Protection: 	VMK protected with passphrase
+	Salt:       	2a 4f 1c 3b 5d 6e 7f 80 91 a2 b3 c4 d5 e6 f7 08
+	Key data size:	44 [bytes]
+ 1: VMK
+	GUID:       	1f2e3d4c-5b6a-4978-8a9b-0c1d2e3f4a5b
+	Protection: 	VMK protected with recovery passphrase
+	Salt:       	11 22 33 44 55 66 77 88 99 aa bb cc dd ee ff 00
+	Key data size:	44 [bytes]
+ 2: FVEK
+	Key data size:	44 [bytes]
+
+Metadata segments:
+ 0: FVE metadata area
+	Offset: 	35651584 [bytes]
+	Size:   	65536 [bytes]
+`
+
+const bitlkMetadataSize = 0x10000
+
+// createBITLKImage writes a minimal BitLocker volume, unlocked by 'passphrase' and described by 'description', to 'path'.
+// It only holds the structures libcryptsetup reads: the volume header, and 3 copies of the FVE metadata,
+// holding the passphrase protected volume master key, the full volume encryption key and the volume description.
+func createBITLKImage(path string, passphrase string, description string, test *testing.T) {
+	salt := randomBytes(16, test)
+	volumeMasterKey := randomBytes(32, test)
+	fullVolumeEncryptionKey := randomBytes(32, test)
+
+	image := make([]byte, 16*bitlkMetadataSize)
+
+	// Volume header, pointing to the FVE metadata copies in the following 3 areas.
+	header := image[:512]
+	copy(header, []byte{0xeb, 0x58, 0x90})
+	copy(header[3:], "-FVE-FS-")
+	binary.LittleEndian.PutUint16(header[11:], 512)
+	copy(header[160:], bitlkGUID("4967d63b-2e29-4ad8-8399-f6a339e3d001", test))
+	for index := 0; index < 3; index++ {
+		binary.LittleEndian.PutUint64(header[176+index*8:], uint64((index+1)*bitlkMetadataSize))
+	}
+
+	// Entries: the volume master key, protected by the passphrase, the full volume encryption key,
+	// protected by the volume master key, the location of the original volume header, and the description.
+	passphraseProtector := make([]byte, 28)
+	copy(passphraseProtector, randomBytes(16, test))
+	binary.LittleEndian.PutUint16(passphraseProtector[26:], 0x2000)
+	passphraseProtector = append(passphraseProtector, bitlkEntry(0x0000, 0x0003, append([]byte{0x00, 0x10, 0x00, 0x00}, salt...))...)
+	passphraseProtector = append(passphraseProtector, bitlkEntry(0x0000, 0x0005, bitlkEncryptedKey(bitlkStretchKey(passphrase, salt), volumeMasterKey, 0x2000, test))...)
+
+	volumeHeader := make([]byte, 16)
+	binary.LittleEndian.PutUint64(volumeHeader, 4*bitlkMetadataSize)
+	binary.LittleEndian.PutUint64(volumeHeader[8:], 8192)
+
+	var utf16Description []byte
+	for _, character := range utf16.Encode([]rune(description)) {
+		utf16Description = append(utf16Description, byte(character), byte(character>>8))
+	}
+
+	var entries []byte
+	entries = append(entries, bitlkEntry(0x0002, 0x0008, passphraseProtector)...)
+	entries = append(entries, bitlkEntry(0x0003, 0x0005, bitlkEncryptedKey(volumeMasterKey, fullVolumeEncryptionKey, 0x8004, test))...)
+	entries = append(entries, bitlkEntry(0x000f, 0x000f, volumeHeader)...)
+	entries = append(entries, bitlkEntry(0x0007, 0x0002, utf16Description)...)
+
+	// FVE metadata block header, followed by the FVE metadata header, using AES-XTS with a 128 bits key.
+	metadata := make([]byte, 112)
+	copy(metadata, "-FVE-FS-")
+	binary.LittleEndian.PutUint16(metadata[10:], 2)
+	binary.LittleEndian.PutUint16(metadata[12:], 4)
+	binary.LittleEndian.PutUint16(metadata[14:], 4)
+	binary.LittleEndian.PutUint64(metadata[16:], uint64(len(image)))
+	binary.LittleEndian.PutUint32(metadata[28:], 16)
+	for index := 0; index < 3; index++ {
+		binary.LittleEndian.PutUint64(metadata[32+index*8:], uint64((index+1)*bitlkMetadataSize))
+	}
+	binary.LittleEndian.PutUint64(metadata[56:], 4*bitlkMetadataSize)
+	binary.LittleEndian.PutUint32(metadata[64:], uint32(48+len(entries)))
+	binary.LittleEndian.PutUint32(metadata[68:], 1)
+	binary.LittleEndian.PutUint32(metadata[72:], 48)
+	binary.LittleEndian.PutUint32(metadata[76:], uint32(48+len(entries)))
+	copy(metadata[80:], randomBytes(16, test))
+	binary.LittleEndian.PutUint16(metadata[100:], 0x8004)
+	binary.LittleEndian.PutUint64(metadata[104:], 133000000000000000)
+	metadata = append(metadata, entries...)
+
+	for index := 1; index <= 3; index++ {
+		copy(image[index*bitlkMetadataSize:], metadata)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteAt(image, 0); err != nil {
+		test.Fatal(err)
+	}
+}
+
+// bitlkEntry builds a FVE metadata entry of type 'entryType', holding a value of type 'valueType'.
+func bitlkEntry(entryType uint16, valueType uint16, value []byte) []byte {
+	entry := make([]byte, 8, 8+len(value))
+	binary.LittleEndian.PutUint16(entry, uint16(8+len(value)))
+	binary.LittleEndian.PutUint16(entry[2:], entryType)
+	binary.LittleEndian.PutUint16(entry[4:], valueType)
+	binary.LittleEndian.PutUint16(entry[6:], 1)
+
+	return append(entry, value...)
+}
+
+// bitlkEncryptedKey encrypts 'key', used by 'method', with 'encryptionKey', as stored in AES-CCM encrypted key entries:
+// a random nonce, the tag, and the encrypted key entry.
+func bitlkEncryptedKey(encryptionKey []byte, key []byte, method uint32, test *testing.T) []byte {
+	keyEntry := make([]byte, 12, 12+len(key))
+	binary.LittleEndian.PutUint16(keyEntry, uint16(12+len(key)))
+	binary.LittleEndian.PutUint16(keyEntry[4:], 0x0001)
+	binary.LittleEndian.PutUint16(keyEntry[6:], 1)
+	binary.LittleEndian.PutUint32(keyEntry[8:], method)
+	keyEntry = append(keyEntry, key...)
+
+	nonce := randomBytes(12, test)
+	tag, ciphertext := aesCCMEncrypt(encryptionKey, nonce, keyEntry, test)
+
+	return append(append(nonce, tag...), ciphertext...)
+}
+
+// bitlkStretchKey derives the key protecting a volume master key from 'passphrase' and 'salt', as BitLocker does.
+func bitlkStretchKey(passphrase string, salt []byte) []byte {
+	var utf16Passphrase []byte
+	for _, character := range utf16.Encode([]rune(passphrase)) {
+		utf16Passphrase = append(utf16Passphrase, byte(character), byte(character>>8))
+	}
+	passphraseHash := sha256.Sum256(utf16Passphrase)
+	passphraseHash = sha256.Sum256(passphraseHash[:])
+
+	// last hash, initial hash, salt and iteration count
+	state := make([]byte, 88)
+	copy(state[32:], passphraseHash[:])
+	copy(state[64:], salt)
+	for iteration := uint64(0); iteration < 0x100000; iteration++ {
+		binary.LittleEndian.PutUint64(state[80:], iteration)
+		lastHash := sha256.Sum256(state)
+		copy(state, lastHash[:])
+	}
+
+	return state[:32]
+}
+
+// aesCCMEncrypt encrypts 'plaintext' using AES-CCM with a 16 bytes tag and no associated data, as specified by RFC 3610.
+func aesCCMEncrypt(key []byte, nonce []byte, plaintext []byte, test *testing.T) (tag []byte, ciphertext []byte) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		test.Fatal(err)
+	}
+	lengthSize := 15 - len(nonce)
+
+	// CBC-MAC over the flags, nonce and length block, followed by the zero padded plaintext.
+	mac := make([]byte, aes.BlockSize)
+	mac[0] = byte(8*((aes.BlockSize-2)/2) + lengthSize - 1)
+	copy(mac[1:], nonce)
+	for index := 0; index < lengthSize; index++ {
+		mac[aes.BlockSize-1-index] = byte(len(plaintext) >> (8 * index))
+	}
+	block.Encrypt(mac, mac)
+	for offset := 0; offset < len(plaintext); offset += aes.BlockSize {
+		for index := 0; index < aes.BlockSize && offset+index < len(plaintext); index++ {
+			mac[index] ^= plaintext[offset+index]
+		}
+		block.Encrypt(mac, mac)
+	}
+
+	// CTR mode, the first counter block encrypting the tag.
+	counter := make([]byte, aes.BlockSize)
+	counter[0] = byte(lengthSize - 1)
+	copy(counter[1:], nonce)
+	stream := cipher.NewCTR(block, counter)
+
+	tag = make([]byte, aes.BlockSize)
+	stream.XORKeyStream(tag, mac)
+	ciphertext = make([]byte, len(plaintext))
+	stream.XORKeyStream(ciphertext, plaintext)
+
+	return tag, ciphertext
+}
+
+// bitlkGUID encodes 'guid' the way BitLocker stores it, with its first 3 groups in little endian.
+func bitlkGUID(guid string, test *testing.T) []byte {
+	encoded, err := hex.DecodeString(strings.ReplaceAll(guid, "-", ""))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, group := range [][]byte{encoded[0:4], encoded[4:6], encoded[6:8]} {
+		for left, right := 0, len(group)-1; left < right; left, right = left+1, right-1 {
+			group[left], group[right] = group[right], group[left]
+		}
+	}
+
+	return encoded
+}
+
+func Test_BITLK_parseBITLKDump(test *testing.T) {
+	info := parseBITLKDump(bitlkDump)
+
+	if info.Version != 2 || info.GUID != "4b5a0df3-8b7b-4cf4-9a3c-4b3cc6e1c3a5" {
+		test.Errorf("Unexpected version or GUID: %d, %s.", info.Version, info.GUID)
+	}
+
+	if info.SectorSize != 512 || info.VolumeSize != 104857600 {
+		test.Errorf("Unexpected sector or volume size: %d, %d.", info.SectorSize, info.VolumeSize)
+	}
+
+	if info.Description != "DESKTOP-TEST Data 19/10/2026" || info.Created != "Wed Oct 19 10:20:30 2026" {
+		test.Errorf("Unexpected description or creation time: %s, %s.", info.Description, info.Created)
+	}
+
+	if info.Cipher != "aes" || info.CipherMode != "xts-plain64" || info.VolumeKeySize != 128/8 {
+		test.Errorf("Unexpected encryption method: %s-%s, %d bytes.", info.Cipher, info.CipherMode, info.VolumeKeySize)
+	}
+
+	if len(info.Protectors) != 2 {
+		test.Fatalf("Expected 2 protectors, got %d.", len(info.Protectors))
+	}
+
+	if info.Protectors[0].GUID != "9e3a2a6b-4c3a-4f0e-9d38-2a8f2d1c3b4e" || info.Protectors[0].Protection != BITLKProtectionPassphrase {
+		test.Errorf("Unexpected first protector: %+v.", info.Protectors[0])
+	}
+
+	if info.Protectors[1].GUID != "1f2e3d4c-5b6a-4978-8a9b-0c1d2e3f4a5b" || info.Protectors[1].Protection != BITLKProtectionRecoveryPassphrase {
+		test.Errorf("Unexpected second protector: %+v.", info.Protectors[1])
+	}
+}
+
+func Test_BITLK_Load_ActivateByPassphrase_Deactivate(test *testing.T) {
+	if !bitlkSupported() {
+		test.Skip("BITLK requires libcryptsetup 2.3 or newer.")
+	}
+
+	testWrapper := TestWrapper{test}
+
+	createBITLKImage(DevicePath, "testPassphrase", "go-cryptsetup test volume", test)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(BITLK{})
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "BITLK" {
+		test.Errorf("Expected type: BITLK, got: %s", device.Type())
+	}
+
+	err = device.ActivateByPassphrase(DeviceName, CRYPT_ANY_SLOT, "testPassphrase", CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertNoError(err)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_BITLK_ActivateByPassphrase_Checks_Passphrase(test *testing.T) {
+	if !bitlkSupported() {
+		test.Skip("BITLK requires libcryptsetup 2.3 or newer.")
+	}
+
+	testWrapper := TestWrapper{test}
+
+	createBITLKImage(DevicePath, "testPassphrase", "go-cryptsetup test volume", test)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(BITLK{})
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByPassphrase("", CRYPT_ANY_SLOT, "testPassphrase", 0)
+	testWrapper.AssertNoError(err)
+
+	// the error code depends on how the crypto backend reports a failed AES-CCM decryption
+	err = device.ActivateByPassphrase("", CRYPT_ANY_SLOT, "wrongPassphrase", 0)
+	testWrapper.AssertError(err)
+}
+
+func Test_BITLK_GetBITLKInfo(test *testing.T) {
+	if !bitlkSupported() {
+		test.Skip("BITLK requires libcryptsetup 2.3 or newer.")
+	}
+
+	testWrapper := TestWrapper{test}
+
+	createBITLKImage(DevicePath, "testPassphrase", "go-cryptsetup test volume", test)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(BITLK{})
+	testWrapper.AssertNoError(err)
+
+	info, err := device.GetBITLKInfo()
+	testWrapper.AssertNoError(err)
+
+	if info.Version != 2 || info.SectorSize != 512 || info.VolumeSize != 16*bitlkMetadataSize {
+		test.Errorf("Unexpected version, sector or volume size: %d, %d, %d.", info.Version, info.SectorSize, info.VolumeSize)
+	}
+
+	if info.Description != "go-cryptsetup test volume" || info.Created == "" || info.GUID == "" {
+		test.Errorf("Unexpected description, creation time or GUID: %s, %s, %s.", info.Description, info.Created, info.GUID)
+	}
+
+	if info.Cipher != "aes" || info.CipherMode != "xts-plain64" || info.VolumeKeySize != 256/8 {
+		test.Errorf("Unexpected encryption method: %s-%s, %d bytes.", info.Cipher, info.CipherMode, info.VolumeKeySize)
+	}
+
+	if len(info.Protectors) != 1 || info.Protectors[0].Protection != BITLKProtectionPassphrase || info.Protectors[0].GUID == "" {
+		test.Errorf("Unexpected protectors: %+v.", info.Protectors)
+	}
+}
+
+func Test_BITLK_Load_Fails_If_Device_Is_Not_BITLK(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.Load(BITLK{})
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_BITLK_GetBITLKInfo_Fails_If_Device_Is_Not_BITLK(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	_, err = device.GetBITLKInfo()
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
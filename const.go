@@ -1,7 +1,26 @@
 package cryptsetup
 
-// #cgo pkg-config: libcryptsetup
-// #include <libcryptsetup.h>
+/*
+#cgo pkg-config: libcryptsetup
+#include <libcryptsetup.h>
+
+// Flags introduced after libcryptsetup 2.0.
+#ifndef CRYPT_ACTIVATE_RECALCULATE
+#define CRYPT_ACTIVATE_RECALCULATE (UINT32_C(1) << 17)
+#endif
+#ifndef CRYPT_ACTIVATE_NO_JOURNAL_BITMAP
+#define CRYPT_ACTIVATE_NO_JOURNAL_BITMAP (UINT32_C(1) << 20)
+#endif
+#ifndef CRYPT_ACTIVATE_NO_READ_WORKQUEUE
+#define CRYPT_ACTIVATE_NO_READ_WORKQUEUE (UINT32_C(1) << 24)
+#endif
+#ifndef CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE
+#define CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE (UINT32_C(1) << 25)
+#endif
+#ifndef CRYPT_ACTIVATE_RECALCULATE_RESET
+#define CRYPT_ACTIVATE_RECALCULATE_RESET (UINT32_C(1) << 26)
+#endif
+*/
 import "C"
 
 const (
@@ -26,15 +45,30 @@ const (
 	/** dm-integrity: direct writes, do not use journal */
 	CRYPT_ACTIVATE_NO_JOURNAL = C.CRYPT_ACTIVATE_NO_JOURNAL
 
+	/** dm-integrity: use bitmap tracking dirty sectors instead of journal */
+	CRYPT_ACTIVATE_NO_JOURNAL_BITMAP = C.CRYPT_ACTIVATE_NO_JOURNAL_BITMAP
+
+	/** dm-crypt: bypass internal workqueue and process read requests synchronously */
+	CRYPT_ACTIVATE_NO_READ_WORKQUEUE = C.CRYPT_ACTIVATE_NO_READ_WORKQUEUE
+
 	/** only reported for device without uuid */
 	CRYPT_ACTIVATE_NO_UUID = C.CRYPT_ACTIVATE_NO_UUID
 
+	/** dm-crypt: bypass internal workqueue and process write requests synchronously */
+	CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE = C.CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE
+
 	/** skip global udev rules in activation ("private device"), input only */
 	CRYPT_ACTIVATE_PRIVATE = C.CRYPT_ACTIVATE_PRIVATE
 
 	/** device is read only */
 	CRYPT_ACTIVATE_READONLY = C.CRYPT_ACTIVATE_READONLY
 
+	/** dm-integrity: recalculate tags automatically */
+	CRYPT_ACTIVATE_RECALCULATE = C.CRYPT_ACTIVATE_RECALCULATE
+
+	/** dm-integrity: reset the recalculation position and recalculate all tags */
+	CRYPT_ACTIVATE_RECALCULATE_RESET = C.CRYPT_ACTIVATE_RECALCULATE_RESET
+
 	/** dm-integrity: recovery mode - no journal, no integrity checks */
 	CRYPT_ACTIVATE_RECOVERY = C.CRYPT_ACTIVATE_RECOVERY
 
@@ -68,6 +102,12 @@ const (
 	/** debug none */
 	CRYPT_DEBUG_NONE = C.CRYPT_DEBUG_NONE
 
+	/** activation flags stored persistently in the LUKS2 header */
+	CRYPT_FLAGS_ACTIVATION = C.CRYPT_FLAGS_ACTIVATION
+
+	/** requirements stored persistently in the LUKS2 header */
+	CRYPT_FLAGS_REQUIREMENTS = C.CRYPT_FLAGS_REQUIREMENTS
+
 	/** integrity dm-integrity device */
 	CRYPT_INTEGRITY = C.CRYPT_INTEGRITY
 
@@ -1,11 +1,80 @@
 package cryptsetup
 
-// #cgo pkg-config: libcryptsetup
-// #include <libcryptsetup.h>
-// #include <stdlib.h>
-//extern int progress_callback(uint64_t size, uint64_t offset, void *usrptr);
+/*
+#cgo pkg-config: libcryptsetup
+#include <errno.h>
+#include <libcryptsetup.h>
+#include <stdlib.h>
+
+extern int progress_callback(uint64_t size, uint64_t offset, void *usrptr);
+
+// Functions introduced after libcryptsetup 2.0 are declared weak and checked at runtime,
+// so the bindings still build and load against older libraries.
+int crypt_activate_by_signed_key(struct crypt_device *cd, const char *name,
+	const char *volume_key, size_t volume_key_size,
+	const char *signature, size_t signature_size,
+	uint32_t flags) __attribute__((weak));
+
+static int crypt_activate_by_signed_key_available(void) {
+	return crypt_activate_by_signed_key != NULL;
+}
+
+int crypt_header_is_detached(struct crypt_device *cd) __attribute__((weak));
+
+static int crypt_header_is_detached_available(void) {
+	return crypt_header_is_detached != NULL;
+}
+
+int crypt_keyslot_get_pbkdf(struct crypt_device *cd, int keyslot, struct crypt_pbkdf_type *pbkdf) __attribute__((weak));
+
+static int crypt_keyslot_get_pbkdf_available(void) {
+	return crypt_keyslot_get_pbkdf != NULL;
+}
+
+const char *crypt_get_label(struct crypt_device *cd) __attribute__((weak));
+const char *crypt_get_subsystem(struct crypt_device *cd) __attribute__((weak));
+
+static int crypt_get_label_available(void) {
+	return crypt_get_label != NULL && crypt_get_subsystem != NULL;
+}
+
+int crypt_set_metadata_size(struct crypt_device *cd, uint64_t metadata_size, uint64_t keyslots_size) __attribute__((weak));
+int crypt_get_metadata_size(struct crypt_device *cd, uint64_t *metadata_size, uint64_t *keyslots_size) __attribute__((weak));
+
+static int crypt_metadata_size_available(void) {
+	return crypt_set_metadata_size != NULL && crypt_get_metadata_size != NULL;
+}
+
+int crypt_set_data_offset(struct crypt_device *cd, uint64_t data_offset) __attribute__((weak));
+
+static int crypt_set_data_offset_available(void) {
+	return crypt_set_data_offset != NULL;
+}
+
+const struct crypt_pbkdf_type *crypt_get_pbkdf_type(struct crypt_device *cd) __attribute__((weak));
+const struct crypt_pbkdf_type *crypt_get_pbkdf_default(const char *type) __attribute__((weak));
+
+static int crypt_get_pbkdf_type_available(void) {
+	return crypt_get_pbkdf_type != NULL && crypt_get_pbkdf_default != NULL;
+}
+
+static const struct crypt_pbkdf_type *get_pbkdf_type(struct crypt_device *cd) {
+	return crypt_get_pbkdf_type != NULL ? crypt_get_pbkdf_type(cd) : NULL;
+}
+
+static const struct crypt_pbkdf_type *get_pbkdf_default(const char *type) {
+	return crypt_get_pbkdf_default != NULL ? crypt_get_pbkdf_default(type) : NULL;
+}
+*/
 import "C"
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"unsafe"
 )
 
@@ -46,6 +115,51 @@ func InitByName(name string) (*Device, error) {
 	return &Device{cryptDevice: cryptDevice}, nil
 }
 
+// InitDataDevice initializes a crypt device using a detached header, where 'headerPath' holds the header
+// and 'dataDevicePath' holds the encrypted data. If 'dataDevicePath' is empty, the header device is used for both.
+// Such devices can be loaded, activated and resized; reencryption isn't wrapped by these bindings.
+// Returns a pointer to the newly allocated Device or any error encountered.
+// C equivalent: crypt_init_data_device
+func InitDataDevice(headerPath string, dataDevicePath string) (*Device, error) {
+	cHeaderPath := C.CString(headerPath)
+	defer C.free(unsafe.Pointer(cHeaderPath))
+
+	var cDataDevicePath *C.char = nil
+	if len(dataDevicePath) > 0 {
+		cDataDevicePath = C.CString(dataDevicePath)
+		defer C.free(unsafe.Pointer(cDataDevicePath))
+	}
+
+	var cryptDevice *C.struct_crypt_device
+	if err := int(C.crypt_init_data_device(&cryptDevice, cHeaderPath, cDataDevicePath)); err < 0 {
+		return nil, &Error{functionName: "crypt_init_data_device", code: err}
+	}
+
+	return &Device{cryptDevice: cryptDevice}, nil
+}
+
+// InitByNameAndHeader initializes a crypt device from provided active device 'name', whose header is stored in 'headerPath'.
+// If 'headerPath' is empty, this is equivalent to InitByName.
+// Returns a pointer to the newly allocated Device or any error encountered.
+// C equivalent: crypt_init_by_name_and_header
+func InitByNameAndHeader(name string, headerPath string) (*Device, error) {
+	activeCryptDeviceName := C.CString(name)
+	defer C.free(unsafe.Pointer(activeCryptDeviceName))
+
+	var cHeaderPath *C.char = nil
+	if len(headerPath) > 0 {
+		cHeaderPath = C.CString(headerPath)
+		defer C.free(unsafe.Pointer(cHeaderPath))
+	}
+
+	var cryptDevice *C.struct_crypt_device
+	if err := int(C.crypt_init_by_name_and_header(&cryptDevice, activeCryptDeviceName, cHeaderPath)); err < 0 {
+		return nil, &Error{functionName: "crypt_init_by_name_and_header", code: err}
+	}
+
+	return &Device{cryptDevice: cryptDevice}, nil
+}
+
 // Free releases crypt device context and used memory.
 // C equivalent: crypt_free
 func (device *Device) Free() bool {
@@ -72,6 +186,10 @@ func (device *Device) Type() string {
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_format
 func (device *Device) Format(deviceType DeviceType, genericParams GenericParams) error {
+	if len(genericParams.VolumeKeyBytes) > 0 && genericParams.VolumeKeySize != 0 && genericParams.VolumeKeySize != len(genericParams.VolumeKeyBytes) {
+		return ErrVolumeKeySize
+	}
+
 	cryptDeviceTypeName := C.CString(deviceType.Name())
 	defer C.free(unsafe.Pointer(cryptDeviceTypeName))
 
@@ -88,12 +206,24 @@ func (device *Device) Format(deviceType DeviceType, genericParams GenericParams)
 	}
 
 	var cVolumeKey *C.char = nil
-	if len(genericParams.VolumeKey) > 0 {
+	if len(genericParams.VolumeKeyBytes) > 0 {
+		cVolumeKey = (*C.char)(C.CBytes(genericParams.VolumeKeyBytes))
+		defer C.free(unsafe.Pointer(cVolumeKey))
+	} else if len(genericParams.VolumeKey) > 0 {
 		cVolumeKey = C.CString(genericParams.VolumeKey)
 		defer C.free(unsafe.Pointer(cVolumeKey))
 	}
 
 	cVolumeKeySize := C.size_t(genericParams.VolumeKeySize)
+	if cVolumeKeySize == 0 {
+		cVolumeKeySize = C.size_t(len(genericParams.VolumeKeyBytes))
+	}
+
+	if luks2, ok := deviceType.(LUKS2); ok && (luks2.MetadataSize > 0 || luks2.KeyslotsSize > 0) {
+		if err := device.SetMetadataSize(luks2.MetadataSize, luks2.KeyslotsSize); err != nil {
+			return err
+		}
+	}
 
 	cTypeParams, freeCTypeParams := deviceType.Unmanaged()
 	defer freeCTypeParams()
@@ -106,6 +236,77 @@ func (device *Device) Format(deviceType DeviceType, genericParams GenericParams)
 	return nil
 }
 
+// SetMetadataSize sets the LUKS2 metadata and keyslots area sizes, in bytes, used by the next Format call.
+// The metadata size must be a power of two between 16 KiB and 4 MiB, and the keyslots size
+// must be a multiple of 4 KiB, up to 128 MiB. Zero keeps the default size.
+// Returns nil on success, or an error otherwise.
+// Requires libcryptsetup 2.1 or newer, older versions return an error with code -95 (ENOTSUP).
+// C equivalent: crypt_set_metadata_size
+func (device *Device) SetMetadataSize(metadataSize uint64, keyslotsSize uint64) error {
+	if C.crypt_metadata_size_available() == 0 {
+		return &Error{functionName: "crypt_set_metadata_size", code: -C.ENOTSUP}
+	}
+
+	err := C.crypt_set_metadata_size(device.cryptDevice, C.uint64_t(metadataSize), C.uint64_t(keyslotsSize))
+	if err < 0 {
+		return &Error{functionName: "crypt_set_metadata_size", code: int(err)}
+	}
+
+	return nil
+}
+
+// MetadataSize gets the LUKS2 metadata and keyslots area sizes, in bytes.
+// Returns both sizes on success, or an error otherwise.
+// Requires libcryptsetup 2.1 or newer, older versions return an error with code -95 (ENOTSUP).
+// C equivalent: crypt_get_metadata_size
+func (device *Device) MetadataSize() (uint64, uint64, error) {
+	if C.crypt_metadata_size_available() == 0 {
+		return 0, 0, &Error{functionName: "crypt_get_metadata_size", code: -C.ENOTSUP}
+	}
+
+	var cMetadataSize, cKeyslotsSize C.uint64_t
+
+	err := C.crypt_get_metadata_size(device.cryptDevice, &cMetadataSize, &cKeyslotsSize)
+	if err < 0 {
+		return 0, 0, &Error{functionName: "crypt_get_metadata_size", code: int(err)}
+	}
+
+	return uint64(cMetadataSize), uint64(cKeyslotsSize), nil
+}
+
+// SetDataOffset sets the data offset, in 512-byte sectors, used by the next LUKS Format call.
+// The offset must be aligned to 4096 bytes, unless it's zero, which keeps the default offset.
+// Returns nil on success, or an error otherwise.
+// Requires libcryptsetup 2.1 or newer, older versions return an error with code -95 (ENOTSUP).
+// C equivalent: crypt_set_data_offset
+func (device *Device) SetDataOffset(dataOffset uint64) error {
+	if C.crypt_set_data_offset_available() == 0 {
+		return &Error{functionName: "crypt_set_data_offset", code: -C.ENOTSUP}
+	}
+
+	err := C.crypt_set_data_offset(device.cryptDevice, C.uint64_t(dataOffset))
+	if err < 0 {
+		return &Error{functionName: "crypt_set_data_offset", code: int(err)}
+	}
+
+	return nil
+}
+
+// SetDataDevice sets the data device of a LUKS device using a detached header.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_data_device
+func (device *Device) SetDataDevice(dataDevicePath string) error {
+	cDataDevicePath := C.CString(dataDevicePath)
+	defer C.free(unsafe.Pointer(cDataDevicePath))
+
+	err := C.crypt_set_data_device(device.cryptDevice, cDataDevicePath)
+	if err < 0 {
+		return &Error{functionName: "crypt_set_data_device", code: int(err)}
+	}
+
+	return nil
+}
+
 var progressCallback func(size, offset uint64) int
 
 //export progress_callback
@@ -128,7 +329,7 @@ func (device *Device) Wipe(devicePath string, pattern int, offset, length uint64
 
 	progressCallback = progress
 
-	err := C.crypt_wipe(device.cryptDevice, cDevicePath, 0, C.uint64_t(offset), C.uint64_t(length), cWipeBlockSize, C.uint32_t(flags), (*[0]byte)(C.progress_callback), nil)
+	err := C.crypt_wipe(device.cryptDevice, cDevicePath, C.crypt_wipe_pattern(pattern), C.uint64_t(offset), C.uint64_t(length), cWipeBlockSize, C.uint32_t(flags), (*[0]byte)(C.progress_callback), nil)
 	if err < 0 {
 		return &Error{functionName: "crypt_wipe", code: int(err)}
 	}
@@ -136,6 +337,40 @@ func (device *Device) Wipe(devicePath string, pattern int, offset, length uint64
 	return nil
 }
 
+// FormatAuthenticated formats a LUKS2 device using authenticated encryption, and initializes its integrity tags.
+// The device is temporarily activated and wiped, otherwise reading unwritten sectors would fail integrity checks.
+// 'progress' is called periodically while wiping, and may be nil.
+// Returns nil on success, ErrNoIntegrity if 'luks2' has no integrity algorithm, or an error otherwise.
+func (device *Device) FormatAuthenticated(luks2 LUKS2, genericParams GenericParams, progress func(size, offset uint64) int) error {
+	if luks2.Integrity == "" {
+		return ErrNoIntegrity
+	}
+
+	if err := device.Format(luks2, genericParams); err != nil {
+		return err
+	}
+
+	temporaryDeviceName := "temporary-cryptsetup-" + device.GetUUID()
+
+	var err error
+	if len(genericParams.VolumeKeyBytes) > 0 {
+		err = device.ActivateByVolumeKeyBytes(temporaryDeviceName, genericParams.VolumeKeyBytes, CRYPT_ACTIVATE_PRIVATE|CRYPT_ACTIVATE_NO_JOURNAL)
+	} else {
+		err = device.ActivateByVolumeKey(temporaryDeviceName, genericParams.VolumeKey, genericParams.VolumeKeySize, CRYPT_ACTIVATE_PRIVATE|CRYPT_ACTIVATE_NO_JOURNAL)
+	}
+	if err != nil {
+		return err
+	}
+
+	wipeErr := device.Wipe("/dev/mapper/"+temporaryDeviceName, CRYPT_WIPE_ENCRYPTED_ZERO, 0, 0, 1024*1024, 0, progress)
+
+	if err := device.Deactivate(temporaryDeviceName); err != nil && wipeErr == nil {
+		return err
+	}
+
+	return wipeErr
+}
+
 // Resize the crypt device.
 // Set newSize to 0 to use all of the underlying device size
 // Returns nil on success, or an error otherwise.
@@ -174,9 +409,71 @@ func (device *Device) Load(deviceType DeviceType) error {
 		return &Error{functionName: "crypt_load", code: int(err)}
 	}
 
+	// libcryptsetup ignores the LUKS data device when loading, so it's set explicitly.
+	var dataDevice string
+	switch deviceType := deviceType.(type) {
+	case LUKS1:
+		dataDevice = deviceType.DataDevice
+	case LUKS2:
+		dataDevice = deviceType.DataDevice
+	}
+
+	if dataDevice != "" {
+		return device.SetDataDevice(dataDevice)
+	}
+
 	return nil
 }
 
+// repairDebugPattern matches the debug messages describing what crypt_repair repaired.
+var repairDebugPattern = regexp.MustCompile(`^((Primary|Secondary) LUKS2 header requires recovery|Repairing keyslots|Repairing JSON metadata)\.$`)
+
+// Repair repairs the device's on-disk header, using the device type parameters if it is specified,
+// otherwise repairing any LUKS header found.
+// Once repaired, the device is loaded.
+// Returns the messages libcryptsetup logged while repairing, describing what was repaired, and nil on success,
+// or the same messages and an error otherwise. Debug messages are left out, except those reporting a LUKS2 header or metadata repair.
+// C equivalent: crypt_repair
+func (device *Device) Repair(deviceType DeviceType) ([]string, error) {
+	var cryptDeviceTypeName *C.char
+	var cTypeParams unsafe.Pointer
+
+	if deviceType != nil {
+		cryptDeviceTypeName = C.CString(deviceType.Name())
+		defer C.free(unsafe.Pointer(cryptDeviceTypeName))
+
+		var freeCTypeParams func()
+		cTypeParams, freeCTypeParams = deviceType.Unmanaged()
+		defer freeCTypeParams()
+	}
+
+	// LUKS2 header recovery is only reported at debug level, which is otherwise not logged.
+	var err C.int
+	C.crypt_set_debug_level(C.CRYPT_DEBUG_ALL)
+	entries := device.captureLog(func() {
+		err = C.crypt_repair(device.cryptDevice, cryptDeviceTypeName, cTypeParams)
+	})
+	C.crypt_set_debug_level(C.int(debugLevel))
+
+	messages := make([]string, 0, len(entries))
+	reported := make(map[string]bool)
+	for _, entry := range entries {
+		message := strings.TrimSuffix(entry.message, "\n")
+		if entry.level == CRYPT_LOG_DEBUG && (!repairDebugPattern.MatchString(message) || reported[message]) {
+			continue
+		}
+
+		messages = append(messages, message)
+		reported[message] = true
+	}
+
+	if err < 0 {
+		return messages, &Error{functionName: "crypt_repair", code: int(err)}
+	}
+
+	return messages, nil
+}
+
 // KeyslotAddByVolumeKey adds a key slot using a volume key to perform the required security check.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_keyslot_add_by_volume_key
@@ -291,6 +588,517 @@ func (device *Device) ActivateByVolumeKey(deviceName string, volumeKey string, v
 	return nil
 }
 
+// ActivateByKeyFile activates a device by using a key file.
+// The key file is read entirely, unless keyFileSize is greater than zero.
+// If deviceName is empty only check the key.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_activate_by_keyfile
+func (device *Device) ActivateByKeyFile(deviceName string, keyslot int, keyFile string, keyFileSize int, flags int) error {
+	var cryptDeviceName *C.char = nil
+	if len(deviceName) > 0 {
+		cryptDeviceName = C.CString(deviceName)
+		defer C.free(unsafe.Pointer(cryptDeviceName))
+	}
+
+	cKeyFile := C.CString(keyFile)
+	defer C.free(unsafe.Pointer(cKeyFile))
+
+	err := C.crypt_activate_by_keyfile(device.cryptDevice, cryptDeviceName, C.int(keyslot), cKeyFile, C.size_t(keyFileSize), C.uint32_t(flags))
+	if err < 0 {
+		return &Error{functionName: "crypt_activate_by_keyfile", code: int(err)}
+	}
+
+	return nil
+}
+
+// ActivateByVolumeKeyBytes activates a device by using a binary volume key.
+// If deviceName is empty only check the volume key.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_activate_by_volume_key
+func (device *Device) ActivateByVolumeKeyBytes(deviceName string, volumeKey []byte, flags int) error {
+	var cryptDeviceName *C.char = nil
+	if len(deviceName) > 0 {
+		cryptDeviceName = C.CString(deviceName)
+		defer C.free(unsafe.Pointer(cryptDeviceName))
+	}
+
+	var cVolumeKey *C.char = nil
+	if len(volumeKey) > 0 {
+		cVolumeKey = (*C.char)(C.CBytes(volumeKey))
+		defer C.free(unsafe.Pointer(cVolumeKey))
+	}
+
+	err := C.crypt_activate_by_volume_key(device.cryptDevice, cryptDeviceName, cVolumeKey, C.size_t(len(volumeKey)), C.uint32_t(flags))
+	if err < 0 {
+		return &Error{functionName: "crypt_activate_by_volume_key", code: int(err)}
+	}
+
+	return nil
+}
+
+// ActivateByRootHash activates a Verity device by using its root hash.
+// If deviceName is empty only check the root hash.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_activate_by_volume_key
+func (device *Device) ActivateByRootHash(deviceName string, rootHash []byte, flags int) error {
+	return device.ActivateByVolumeKeyBytes(deviceName, rootHash, flags)
+}
+
+// ActivateBySignedRootHash activates a Verity device by using its root hash and a PKCS#7 signature of it.
+// The signature is verified by the kernel against its trusted keyring.
+// Requires libcryptsetup 2.3 or newer, older versions return an error with code -95 (ENOTSUP).
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_activate_by_signed_key
+func (device *Device) ActivateBySignedRootHash(deviceName string, rootHash []byte, signature []byte, flags int) error {
+	if C.crypt_activate_by_signed_key_available() == 0 {
+		return &Error{functionName: "crypt_activate_by_signed_key", code: -C.ENOTSUP}
+	}
+
+	var cryptDeviceName *C.char = nil
+	if len(deviceName) > 0 {
+		cryptDeviceName = C.CString(deviceName)
+		defer C.free(unsafe.Pointer(cryptDeviceName))
+	}
+
+	var cRootHash *C.char = nil
+	if len(rootHash) > 0 {
+		cRootHash = (*C.char)(C.CBytes(rootHash))
+		defer C.free(unsafe.Pointer(cRootHash))
+	}
+
+	var cSignature *C.char = nil
+	if len(signature) > 0 {
+		cSignature = (*C.char)(C.CBytes(signature))
+		defer C.free(unsafe.Pointer(cSignature))
+	}
+
+	err := C.crypt_activate_by_signed_key(
+		device.cryptDevice, cryptDeviceName,
+		cRootHash, C.size_t(len(rootHash)),
+		cSignature, C.size_t(len(signature)),
+		C.uint32_t(flags),
+	)
+	if err < 0 {
+		return &Error{functionName: "crypt_activate_by_signed_key", code: int(err)}
+	}
+
+	return nil
+}
+
+// ActivateIntegrity activates a standalone Integrity device.
+// The device is loaded again using the activation's IntegrityParams, since journal keys can only be provided when loading.
+// IntegrityModeBitmap, Recalculate and ResetRecalculate require a libcryptsetup version supporting them, as older versions
+// would silently activate the device in journal mode. If they're not supported, or if the active device doesn't report
+// the requested mode, the device isn't left active, and an error with code -95 (ENOTSUP) is returned.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_activate_by_volume_key
+func (device *Device) ActivateIntegrity(deviceName string, activation IntegrityActivation) error {
+	if !activation.supported() {
+		return &Error{functionName: "crypt_activate_by_volume_key", code: -C.ENOTSUP}
+	}
+
+	if err := device.Load(Integrity{activation.IntegrityParams}); err != nil {
+		return err
+	}
+
+	if err := device.ActivateByVolumeKey(deviceName, activation.IntegrityKey, len(activation.IntegrityKey), activation.flags()); err != nil {
+		return err
+	}
+
+	if deviceName == "" || activation.modeFlag() == 0 {
+		return nil
+	}
+
+	activeDevice, err := device.GetActiveDevice(deviceName)
+	if err != nil {
+		return err
+	}
+
+	if activeDevice.Flags&activation.modeFlag() == 0 {
+		if err := device.Deactivate(deviceName); err != nil {
+			return err
+		}
+		return &Error{functionName: "crypt_activate_by_volume_key", code: -C.ENOTSUP}
+	}
+
+	return nil
+}
+
+// VerifyVerity verifies a loaded Verity device's data and hash areas against 'rootHash' in userspace, without creating a mapping.
+// The device is loaded again to enable CRYPT_VERITY_CHECK_HASH, then loaded once more with its original flags.
+// As libcryptsetup can't load devices without an on-disk header, those are set up again on a new crypt device instead,
+// using every parameter returned by GetVerityInfo().
+// If that last load fails, its error is returned, wrapped in a *RestoreError if verification failed too.
+// If the device uses FEC, blocks failing verification are checked against the FEC data, and verification succeeds
+// if they can all be repaired. Their number is then reported in the returned VerityVerification.
+// Returns the verification's outcome on success, a *VerityVerificationError identifying the failing block if verification fails,
+// or an error otherwise.
+// C equivalent: crypt_activate_by_volume_key
+func (device *Device) VerifyVerity(rootHash []byte) (verification VerityVerification, err error) {
+	verity, err := device.GetVerityInfo()
+	if err != nil {
+		return VerityVerification{}, err
+	}
+
+	// Without an on-disk header, the parameters can only come from the loaded device.
+	reload := verity
+	if verity.Flags&CRYPT_VERITY_NO_HEADER == 0 {
+		reload = Verity{
+			DataDevice:     verity.DataDevice,
+			FECDevice:      verity.FECDevice,
+			HashAreaOffset: verity.HashAreaOffset,
+			FECAreaOffset:  verity.FECAreaOffset,
+			FECRoots:       verity.FECRoots,
+		}
+	}
+
+	reload.Flags = verity.Flags | CRYPT_VERITY_CHECK_HASH
+	if err := device.setupVerity(reload); err != nil {
+		return VerityVerification{}, err
+	}
+
+	reload.Flags = verity.Flags
+	defer func() {
+		if reloadErr := device.setupVerity(reload); reloadErr != nil {
+			if err == nil {
+				err = reloadErr
+			} else {
+				err = &RestoreError{Err: err, RestoreErr: reloadErr}
+			}
+		}
+	}()
+
+	var cRootHash *C.char = nil
+	if len(rootHash) > 0 {
+		cRootHash = (*C.char)(C.CBytes(rootHash))
+		defer C.free(unsafe.Pointer(cRootHash))
+	}
+
+	var cErr C.int
+	entries := device.captureLog(func() {
+		cErr = C.crypt_activate_by_volume_key(device.cryptDevice, nil, cRootHash, C.size_t(len(rootHash)), 0)
+	})
+	if cErr < 0 {
+		return VerityVerification{}, newVerityVerificationError(
+			&Error{functionName: "crypt_activate_by_volume_key", code: int(cErr)},
+			entries, verity, len(rootHash),
+		)
+	}
+
+	return newVerityVerification(entries), nil
+}
+
+// setupVerity loads a Verity device using 'verity'.
+// Devices without an on-disk header can't be loaded, so a new crypt device is initialized using the hash device,
+// and formatted using 'verity' instead, which doesn't write anything as long as CRYPT_VERITY_CREATE_HASH isn't set.
+// It then replaces the device's crypt device.
+func (device *Device) setupVerity(verity Verity) error {
+	if verity.Flags&CRYPT_VERITY_NO_HEADER == 0 {
+		return device.Load(verity)
+	}
+
+	headerless, err := Init(verity.HashDevice)
+	if err != nil {
+		return err
+	}
+
+	if err := headerless.Format(verity, GenericParams{}); err != nil {
+		headerless.Free()
+		return err
+	}
+
+	C.crypt_free(device.cryptDevice)
+	device.cryptDevice = headerless.cryptDevice
+
+	return nil
+}
+
+// GetVerityInfo gets the parameters of a loaded Verity device.
+// Returns a populated Verity struct on success, or an error otherwise.
+// C equivalent: crypt_get_verity_info
+func (device *Device) GetVerityInfo() (Verity, error) {
+	var cParams C.struct_crypt_params_verity
+	if err := C.crypt_get_verity_info(device.cryptDevice, &cParams); err < 0 {
+		return Verity{}, &Error{functionName: "crypt_get_verity_info", code: int(err)}
+	}
+
+	verity := Verity{
+		HashName:       C.GoString(cParams.hash_name),
+		DataDevice:     C.GoString(cParams.data_device),
+		HashDevice:     C.GoString(cParams.hash_device),
+		FECDevice:      C.GoString(cParams.fec_device),
+		SaltSize:       uint32(cParams.salt_size),
+		HashType:       uint32(cParams.hash_type),
+		DataBlockSize:  uint32(cParams.data_block_size),
+		HashBlockSize:  uint32(cParams.hash_block_size),
+		DataSize:       uint64(cParams.data_size),
+		HashAreaOffset: uint64(cParams.hash_area_offset),
+		FECAreaOffset:  uint64(cParams.fec_area_offset),
+		FECRoots:       uint32(cParams.fec_roots),
+		Flags:          uint32(cParams.flags),
+	}
+	if cParams.salt != nil && cParams.salt_size > 0 {
+		verity.Salt = C.GoBytes(unsafe.Pointer(cParams.salt), C.int(cParams.salt_size))
+	}
+
+	return verity, nil
+}
+
+// GetVerityRootHash gets the root hash of a Verity device.
+// The root hash is only known after Format(), or for active devices initialized using InitByName().
+// Returns the root hash on success, or an error otherwise.
+// C equivalent: crypt_volume_key_get
+func (device *Device) GetVerityRootHash() ([]byte, error) {
+	rootHash, _, err := device.VolumeKeyGet(C.CRYPT_ANY_SLOT, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return rootHash, nil
+}
+
+// GetIntegrityInfo gets the integrity parameters of a loaded Integrity device, or of a LUKS2 device using integrity protection.
+// Journal keys are never returned.
+// Returns a populated IntegrityParams struct on success, or an error otherwise.
+// C equivalent: crypt_get_integrity_info
+func (device *Device) GetIntegrityInfo() (IntegrityParams, error) {
+	var cParams C.struct_crypt_params_integrity
+	if err := C.crypt_get_integrity_info(device.cryptDevice, &cParams); err < 0 {
+		return IntegrityParams{}, &Error{functionName: "crypt_get_integrity_info", code: int(err)}
+	}
+
+	return IntegrityParams{
+		JournalSize:       uint64(cParams.journal_size),
+		JournalWatermark:  uint(cParams.journal_watermark),
+		JournalCommitTime: uint(cParams.journal_commit_time),
+
+		InterleaveSectors: uint32(cParams.interleave_sectors),
+		TagSize:           uint32(cParams.tag_size),
+		SectorSize:        uint32(cParams.sector_size),
+		BufferSectors:     uint32(cParams.buffer_sectors),
+
+		Integrity:        C.GoString(cParams.integrity),
+		IntegrityKeySize: uint32(cParams.integrity_key_size),
+
+		JournalIntegrity:        C.GoString(cParams.journal_integrity),
+		JournalIntegrityKeySize: uint32(cParams.journal_integrity_key_size),
+
+		JournalCrypt:        C.GoString(cParams.journal_crypt),
+		JournalCryptKeySize: uint32(cParams.journal_crypt_key_size),
+	}, nil
+}
+
+// GetBITLKInfo gets the metadata of a loaded BITLK device, including its protectors and encryption method.
+// libcryptsetup only exposes this metadata through its header dump, which is parsed here.
+// Returns a populated BITLKInfo struct on success, or an error otherwise.
+// C equivalent: crypt_dump
+func (device *Device) GetBITLKInfo() (BITLKInfo, error) {
+	if device.Type() != (BITLK{}).Name() {
+		return BITLKInfo{}, &Error{functionName: "crypt_dump", code: -C.EINVAL}
+	}
+
+	var cErr C.int
+	entries := device.captureLog(func() {
+		cErr = C.crypt_dump(device.cryptDevice)
+	})
+	if cErr < 0 {
+		return BITLKInfo{}, &Error{functionName: "crypt_dump", code: int(cErr)}
+	}
+
+	var dump strings.Builder
+	for _, entry := range entries {
+		if entry.level == CRYPT_LOG_NORMAL {
+			dump.WriteString(entry.message)
+		}
+	}
+
+	return parseBITLKDump(dump.String()), nil
+}
+
+// HeaderBackup stores a binary backup of the device's LUKS header and keyslot area in 'backupFile', which must not exist.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_header_backup
+func (device *Device) HeaderBackup(backupFile string) error {
+	cBackupFile := C.CString(backupFile)
+	defer C.free(unsafe.Pointer(cBackupFile))
+
+	err := C.crypt_header_backup(device.cryptDevice, nil, cBackupFile)
+	if err < 0 {
+		return &Error{functionName: "crypt_header_backup", code: int(err)}
+	}
+
+	return nil
+}
+
+// HeaderRestore restores the device's LUKS header and keyslot area from 'backupFile'.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_header_restore
+func (device *Device) HeaderRestore(backupFile string) error {
+	cBackupFile := C.CString(backupFile)
+	defer C.free(unsafe.Pointer(cBackupFile))
+
+	err := C.crypt_header_restore(device.cryptDevice, nil, cBackupFile)
+	if err < 0 {
+		return &Error{functionName: "crypt_header_restore", code: int(err)}
+	}
+
+	return nil
+}
+
+// HeaderBackupTo writes a binary backup of the device's LUKS header and keyslot area to 'writer'.
+// The backup is staged in a private temporary directory, which is removed before returning.
+// Returns the number of bytes written on success, or an error otherwise.
+func (device *Device) HeaderBackupTo(writer io.Writer) (int64, error) {
+	directory, err := ioutil.TempDir("", "go-cryptsetup-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(directory)
+
+	backupFile := filepath.Join(directory, "header")
+	if err := device.HeaderBackup(backupFile); err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(backupFile)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if err := checkHeaderBackup(file); err != nil {
+		return 0, err
+	}
+
+	return io.Copy(writer, file)
+}
+
+// HeaderRestoreFrom restores the device's LUKS header and keyslot area from a binary backup read from 'reader'.
+// The backup is checked before being restored, and staged in a private temporary directory, which is removed before returning.
+// Returns nil on success, or an error otherwise.
+func (device *Device) HeaderRestoreFrom(reader io.Reader) error {
+	directory, err := ioutil.TempDir("", "go-cryptsetup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(directory)
+
+	backupFile := filepath.Join(directory, "header")
+	file, err := os.OpenFile(backupFile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, reader); err != nil {
+		return err
+	}
+
+	if err := checkHeaderBackup(file); err != nil {
+		return err
+	}
+
+	return device.HeaderRestore(backupFile)
+}
+
+// Convert converts a loaded LUKS1 device to LUKS2, or a loaded LUKS2 device to LUKS1.
+// Only the Name() of 'to' is used. Before converting to LUKS1, the device is checked
+// so that keyslots, tokens and integrity protection are never lost silently.
+// A header backup is written to 'backup' first, so that it survives if the process dies while converting;
+// 'backup' may be nil, in which case the backup is only kept in memory.
+// If the conversion fails after modifying the on-disk header, the backup is restored.
+// Returns nil on success, or an error otherwise. If restoring the backup fails as well, a *RestoreError holding both errors is returned.
+// Converting to LUKS1 requires crypt_keyslot_get_pbkdf, which libcryptsetup 2.0.2 lacks; without it, an error with code -95 (ENOTSUP) is returned.
+// C equivalent: crypt_convert
+func (device *Device) Convert(to DeviceType, backup io.Writer) error {
+	if to.Name() != C.CRYPT_LUKS1 && to.Name() != C.CRYPT_LUKS2 {
+		return &Error{functionName: "crypt_convert", code: -C.EINVAL}
+	}
+
+	if device.Type() == C.CRYPT_LUKS2 && to.Name() == C.CRYPT_LUKS1 {
+		if err := device.checkConvertToLUKS1(); err != nil {
+			return err
+		}
+	}
+
+	var headerBefore bytes.Buffer
+	writer := io.Writer(&headerBefore)
+	if backup != nil {
+		writer = io.MultiWriter(&headerBefore, backup)
+	}
+
+	if _, err := device.HeaderBackupTo(writer); err != nil {
+		return err
+	}
+
+	cType := C.CString(to.Name())
+	defer C.free(unsafe.Pointer(cType))
+
+	res := C.crypt_convert(device.cryptDevice, cType, nil)
+	if res < 0 {
+		err := &Error{functionName: "crypt_convert", code: int(res)}
+
+		// Most failures are detected before anything is written, and the header must then be left alone.
+		var headerAfter bytes.Buffer
+		if _, backupErr := device.HeaderBackupTo(&headerAfter); backupErr == nil && bytes.Equal(headerBefore.Bytes(), headerAfter.Bytes()) {
+			return err
+		}
+
+		if restoreErr := device.HeaderRestoreFrom(&headerBefore); restoreErr != nil {
+			return &RestoreError{Err: err, RestoreErr: restoreErr}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// checkConvertToLUKS1 checks that a LUKS2 device only uses features LUKS1 supports.
+func (device *Device) checkConvertToLUKS1() error {
+	if C.crypt_keyslot_get_pbkdf_available() == 0 {
+		return &Error{functionName: "crypt_keyslot_get_pbkdf", code: -C.ENOTSUP}
+	}
+
+	cType := C.CString(C.CRYPT_LUKS2)
+	defer C.free(unsafe.Pointer(cType))
+
+	for keyslot := 0; keyslot < int(C.crypt_keyslot_max(cType)); keyslot++ {
+		status := C.crypt_keyslot_status(device.cryptDevice, C.int(keyslot))
+		if status == C.CRYPT_SLOT_INVALID || status == C.CRYPT_SLOT_INACTIVE {
+			continue
+		}
+
+		var cPBKDF C.struct_crypt_pbkdf_type
+		if err := C.crypt_keyslot_get_pbkdf(device.cryptDevice, C.int(keyslot), &cPBKDF); err < 0 {
+			return &Error{functionName: "crypt_keyslot_get_pbkdf", code: int(err)}
+		}
+
+		if C.GoString(cPBKDF._type) != C.CRYPT_KDF_PBKDF2 {
+			return ErrConvertUnsupportedPBKDF
+		}
+	}
+
+	for token := 0; ; token++ {
+		status := C.crypt_token_status(device.cryptDevice, C.int(token), nil)
+		if status == C.CRYPT_TOKEN_INVALID {
+			break
+		}
+		if status != C.CRYPT_TOKEN_INACTIVE {
+			return ErrConvertTokens
+		}
+	}
+
+	integrityParams, err := device.GetIntegrityInfo()
+	if err != nil {
+		return err
+	}
+	if integrityParams.Integrity != "" {
+		return ErrConvertIntegrity
+	}
+
+	return nil
+}
+
 // Deactivate deactivates a device.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_deactivate
@@ -306,12 +1114,223 @@ func (device *Device) Deactivate(deviceName string) error {
 	return nil
 }
 
+// ActiveDevice holds runtime information about an active device.
+type ActiveDevice struct {
+	Offset   uint64
+	IVOffset uint64
+	Size     uint64
+	Flags    uint32
+}
+
+// GetActiveDevice gets runtime information about the active device 'deviceName'.
+// For Verity devices, CRYPT_ACTIVATE_CORRUPTED is set in Flags once the kernel
+// has detected corruption, regardless of whether it could be corrected using FEC.
+// The number of errors FEC can repair is reported by VerifyVerity().
+// Returns the active device's information on success, or an error otherwise.
+// C equivalent: crypt_get_active_device
+func (device *Device) GetActiveDevice(deviceName string) (ActiveDevice, error) {
+	cryptDeviceName := C.CString(deviceName)
+	defer C.free(unsafe.Pointer(cryptDeviceName))
+
+	var cActiveDevice C.struct_crypt_active_device
+	err := C.crypt_get_active_device(device.cryptDevice, cryptDeviceName, &cActiveDevice)
+	if err < 0 {
+		return ActiveDevice{}, &Error{functionName: "crypt_get_active_device", code: int(err)}
+	}
+
+	return ActiveDevice{
+		Offset:   uint64(cActiveDevice.offset),
+		IVOffset: uint64(cActiveDevice.iv_offset),
+		Size:     uint64(cActiveDevice.size),
+		Flags:    uint32(cActiveDevice.flags),
+	}, nil
+}
+
+// PersistentFlagsSet stores flags in the LUKS2 header, replacing the flags previously stored.
+// 'flagsType' is either CRYPT_FLAGS_ACTIVATION, for CRYPT_ACTIVATE_* flags applied on every activation,
+// or CRYPT_FLAGS_REQUIREMENTS, for CRYPT_REQUIREMENT_* flags.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_persistent_flags_set
+func (device *Device) PersistentFlagsSet(flagsType int, flags uint32) error {
+	err := C.crypt_persistent_flags_set(device.cryptDevice, C.crypt_flags_type(flagsType), C.uint32_t(flags))
+	if err < 0 {
+		return &Error{functionName: "crypt_persistent_flags_set", code: int(err)}
+	}
+
+	return nil
+}
+
+// PersistentFlagsGet gets the flags stored in the LUKS2 header.
+// 'flagsType' is either CRYPT_FLAGS_ACTIVATION or CRYPT_FLAGS_REQUIREMENTS.
+// Returns the flags on success, or an error otherwise.
+// C equivalent: crypt_persistent_flags_get
+func (device *Device) PersistentFlagsGet(flagsType int) (uint32, error) {
+	var cFlags C.uint32_t
+
+	err := C.crypt_persistent_flags_get(device.cryptDevice, C.crypt_flags_type(flagsType), &cFlags)
+	if err < 0 {
+		return 0, &Error{functionName: "crypt_persistent_flags_get", code: int(err)}
+	}
+
+	return uint32(cFlags), nil
+}
+
+// Requirements holds the requirements stored in a LUKS2 header.
+// Devices with requirements can't be used by libraries not supporting them.
+type Requirements struct {
+	// OfflineReencrypt means an offline reencryption was left unfinished.
+	OfflineReencrypt bool
+	// Unknown means the header holds requirements this libcryptsetup version doesn't know about.
+	Unknown bool
+}
+
+// GetRequirements gets the requirements stored in the LUKS2 header.
+// Returns a populated Requirements struct on success, or an error otherwise.
+// C equivalent: crypt_persistent_flags_get
+func (device *Device) GetRequirements() (Requirements, error) {
+	flags, err := device.PersistentFlagsGet(CRYPT_FLAGS_REQUIREMENTS)
+	if err != nil {
+		return Requirements{}, err
+	}
+
+	return Requirements{
+		OfflineReencrypt: flags&CRYPT_REQUIREMENT_OFFLINE_REENCRYPT != 0,
+		Unknown:          flags&CRYPT_REQUIREMENT_UNKNOWN != 0,
+	}, nil
+}
+
+// SetPBKDF sets the PBKDF used for new keyslots, as with KeyslotAddByPassphrase.
+// Passing nil resets it to the default PBKDF of the device type.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_pbkdf_type
+func (device *Device) SetPBKDF(pbkdfType *PbkdfType) error {
+	var cPBKDFType *C.struct_crypt_pbkdf_type
+
+	if pbkdfType != nil {
+		deallocations := make([]func(), 0)
+		defer func() {
+			for index := 0; index < len(deallocations); index++ {
+				deallocations[index]()
+			}
+		}()
+
+		cPBKDFType = pbkdfType.unmanaged(&deallocations)
+	}
+
+	err := C.crypt_set_pbkdf_type(device.cryptDevice, cPBKDFType)
+	if err < 0 {
+		return &Error{functionName: "crypt_set_pbkdf_type", code: int(err)}
+	}
+
+	return nil
+}
+
+// PBKDF returns the PBKDF used for new keyslots, or nil if it can't be determined,
+// which is always the case with libcryptsetup versions lacking crypt_get_pbkdf_type.
+// C equivalent: crypt_get_pbkdf_type
+func (device *Device) PBKDF() *PbkdfType {
+	return newPbkdfType(C.get_pbkdf_type(device.cryptDevice))
+}
+
+// DefaultPBKDF returns the default PBKDF of a device type, or nil if the device type has none,
+// which is always the case with libcryptsetup versions lacking crypt_get_pbkdf_default.
+// C equivalent: crypt_get_pbkdf_default
+func DefaultPBKDF(deviceType DeviceType) *PbkdfType {
+	cDeviceTypeName := C.CString(deviceType.Name())
+	defer C.free(unsafe.Pointer(cDeviceTypeName))
+
+	return newPbkdfType(C.get_pbkdf_default(cDeviceTypeName))
+}
+
+// pbkdfTypeSupported reports whether the loaded libcryptsetup can report PBKDFs through PBKDF() and DefaultPBKDF().
+func pbkdfTypeSupported() bool {
+	return C.crypt_get_pbkdf_type_available() != 0
+}
+
 // SetDebugLevel sets the debug level for the library.
 // C equivalent: crypt_set_debug_level
-func SetDebugLevel(debugLevel int) {
+func SetDebugLevel(newDebugLevel int) {
+	debugLevel = newDebugLevel
 	C.crypt_set_debug_level(C.int(debugLevel))
 }
 
+// SetMetadataLocking enables or disables metadata locking for every device, which is enabled by default.
+// Disabling it allows working with headers in read-only environments, where lock files can't be created.
+// Once disabled, metadata locking can't be enabled again for the lifetime of the process.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_metadata_locking
+func SetMetadataLocking(enable bool) error {
+	cEnable := C.int(0)
+	if enable {
+		cEnable = 1
+	}
+
+	err := C.crypt_metadata_locking(nil, cEnable)
+	if err < 0 {
+		return &Error{functionName: "crypt_metadata_locking", code: int(err)}
+	}
+
+	return nil
+}
+
+// RNGType selects the random number generator used by a device, either CRYPT_RNG_URANDOM or CRYPT_RNG_RANDOM.
+type RNGType int
+
+// SetRNGType sets the random number generator used by the device.
+// C equivalent: crypt_set_rng_type
+func (device *Device) SetRNGType(rngType RNGType) {
+	C.crypt_set_rng_type(device.cryptDevice, C.int(rngType))
+}
+
+// RNGType gets the random number generator used by the device.
+// Returns the random number generator on success, or an error otherwise.
+// C equivalent: crypt_get_rng_type
+func (device *Device) RNGType() (RNGType, error) {
+	rngType := C.crypt_get_rng_type(device.cryptDevice)
+	if rngType < 0 {
+		return 0, &Error{functionName: "crypt_get_rng_type", code: int(rngType)}
+	}
+
+	return RNGType(rngType), nil
+}
+
+// SetIterationTime sets the time, in milliseconds, the PBKDF of new keyslots should take.
+// C equivalent: crypt_set_iteration_time
+func (device *Device) SetIterationTime(iterationTimeMs uint64) {
+	C.crypt_set_iteration_time(device.cryptDevice, C.uint64_t(iterationTimeMs))
+}
+
+// MemoryLock locks or unlocks the process memory, preventing keys from being swapped out.
+// Returns true if the memory is locked.
+// Recent libcryptsetup versions lock memory on their own, and ignore this call.
+// C equivalent: crypt_memory_lock
+func (device *Device) MemoryLock(lock bool) bool {
+	cLock := C.int(0)
+	if lock {
+		cLock = 1
+	}
+
+	return C.crypt_memory_lock(device.cryptDevice, cLock) == 1
+}
+
+// VolumeKeyVerify checks a volume key against the device's header, without activating the device.
+// Returns nil if the volume key matches, or an error otherwise.
+// C equivalent: crypt_volume_key_verify
+func (device *Device) VolumeKeyVerify(volumeKey []byte) error {
+	var cVolumeKey *C.char = nil
+	if len(volumeKey) > 0 {
+		cVolumeKey = (*C.char)(C.CBytes(volumeKey))
+		defer C.free(unsafe.Pointer(cVolumeKey))
+	}
+
+	err := C.crypt_volume_key_verify(device.cryptDevice, cVolumeKey, C.size_t(len(volumeKey)))
+	if err < 0 {
+		return &Error{functionName: "crypt_volume_key_verify", code: int(err)}
+	}
+
+	return nil
+}
+
 // VolumeKeyGet gets the volume key from a crypt device.
 // Returns a slice of bytes having the volume key and the unlocked key slot number, or an error otherwise.
 // C equivalent: crypt_volume_key_get
@@ -344,9 +1363,111 @@ func (device *Device) GetDeviceName() string {
 	return C.GoString(res)
 }
 
+// GetMetadataDeviceName gets the path to the device holding the header, if it's detached.
+// Returns an empty string if the header isn't detached.
+// C equivalent: crypt_get_metadata_device_name
+func (device *Device) GetMetadataDeviceName() string {
+	res := C.crypt_get_metadata_device_name(device.cryptDevice)
+	return C.GoString(res)
+}
+
+// GetDataOffset gets the data offset, in 512-byte sectors.
+// C equivalent: crypt_get_data_offset
+func (device *Device) GetDataOffset() uint64 {
+	return uint64(C.crypt_get_data_offset(device.cryptDevice))
+}
+
+// HeaderIsDetached checks whether the device's header is stored separately from its data.
+// Returns true if the header is detached, false if it isn't, or an error otherwise.
+// Requires libcryptsetup 2.4 or newer, older versions return an error with code -95 (ENOTSUP).
+// C equivalent: crypt_header_is_detached
+func (device *Device) HeaderIsDetached() (bool, error) {
+	if C.crypt_header_is_detached_available() == 0 {
+		return false, &Error{functionName: "crypt_header_is_detached", code: -C.ENOTSUP}
+	}
+
+	res := C.crypt_header_is_detached(device.cryptDevice)
+	if res < 0 {
+		return false, &Error{functionName: "crypt_header_is_detached", code: int(res)}
+	}
+
+	return res == 1, nil
+}
+
 // GetUUID gets the device's UUID.
 // C equivalent: crypt_get_uuid
 func (device *Device) GetUUID() string {
 	res := C.crypt_get_uuid(device.cryptDevice)
 	return C.GoString(res)
 }
+
+// SetUUID sets the device's UUID. If 'uuid' is empty, a new UUID is generated.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_uuid
+func (device *Device) SetUUID(uuid string) error {
+	var cUUID *C.char = nil
+	if len(uuid) > 0 {
+		cUUID = C.CString(uuid)
+		defer C.free(unsafe.Pointer(cUUID))
+	}
+
+	err := C.crypt_set_uuid(device.cryptDevice, cUUID)
+	if err < 0 {
+		return &Error{functionName: "crypt_set_uuid", code: int(err)}
+	}
+
+	return nil
+}
+
+// SetLabel sets the LUKS2 device's label and subsystem. Empty values remove them.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_label
+func (device *Device) SetLabel(label string, subsystem string) error {
+	var cLabel *C.char = nil
+	if len(label) > 0 {
+		cLabel = C.CString(label)
+		defer C.free(unsafe.Pointer(cLabel))
+	}
+
+	var cSubsystem *C.char = nil
+	if len(subsystem) > 0 {
+		cSubsystem = C.CString(subsystem)
+		defer C.free(unsafe.Pointer(cSubsystem))
+	}
+
+	err := C.crypt_set_label(device.cryptDevice, cLabel, cSubsystem)
+	if err < 0 {
+		return &Error{functionName: "crypt_set_label", code: int(err)}
+	}
+
+	return nil
+}
+
+// Label gets the LUKS2 device's label.
+// Returns an empty string if the device has no label, or if libcryptsetup is older than 2.5.
+// C equivalent: crypt_get_label
+func (device *Device) Label() string {
+	if C.crypt_get_label_available() == 0 {
+		return ""
+	}
+
+	res := C.crypt_get_label(device.cryptDevice)
+	return C.GoString(res)
+}
+
+// Subsystem gets the LUKS2 device's subsystem.
+// Returns an empty string if the device has no subsystem, or if libcryptsetup is older than 2.5.
+// C equivalent: crypt_get_subsystem
+func (device *Device) Subsystem() string {
+	if C.crypt_get_label_available() == 0 {
+		return ""
+	}
+
+	res := C.crypt_get_subsystem(device.cryptDevice)
+	return C.GoString(res)
+}
+
+// labelSupported reports whether the loaded libcryptsetup can read labels and subsystems.
+func labelSupported() bool {
+	return C.crypt_get_label_available() != 0
+}
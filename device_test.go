@@ -1,6 +1,10 @@
 package cryptsetup
 
 import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
 	"testing"
 )
 
@@ -31,6 +35,22 @@ func Test_Device_InitByName_Fails_If_Device_Is_Not_Active(test *testing.T) {
 	testWrapper.AssertErrorCodeEquals(err, -19)
 }
 
+func Test_Device_InitDataDevice_Fails_If_Header_Is_Not_Found(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	_, err := InitDataDevice("nonExistingHeaderPath", DevicePath)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -15)
+}
+
+func Test_Device_InitByNameAndHeader_Fails_If_Device_Is_Not_Active(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	_, err := InitByNameAndHeader("nonExistingMappedDevice", HeaderDevicePath)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -19)
+}
+
 func Test_Device_Free_Works(test *testing.T) {
 	testWrapper := TestWrapper{test}
 
@@ -260,3 +280,308 @@ func Test_Device_GetUUID(test *testing.T) {
 		test.Errorf("Returned a different UUID than was set for the device: got %s, expected %s", uid, newUUID)
 	}
 }
+
+func Test_Device_GetActiveDevice_Fails_If_Device_Is_Not_Active(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	_, err = device.GetActiveDevice("nonExistingMappedDevice")
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -19)
+}
+
+func Test_Device_HeaderIsDetached_Returns_False_If_Device_Has_No_Type(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	detached, err := device.HeaderIsDetached()
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+	if detached {
+		test.Error("Header should not be detached.")
+	}
+}
+
+func Test_Device_SetUUID(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	newUUID := "12345678-1234-1234-1234-12345678abcd"
+	err = device.SetUUID(newUUID)
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	if device.GetUUID() != newUUID {
+		test.Errorf("UUID should be '%s', but '%s' was returned instead.", newUUID, device.GetUUID())
+	}
+
+	err = device.SetUUID("")
+	testWrapper.AssertNoError(err)
+
+	if device.GetUUID() == newUUID || device.GetUUID() == "" {
+		test.Error("Should have generated a new UUID.")
+	}
+}
+
+func Test_Device_SetUUID_Fails_If_UUID_Is_Invalid(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.SetUUID("invalid")
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_Device_SetLabel_Label_Subsystem(test *testing.T) {
+	if !labelSupported() {
+		test.Skip("Label and Subsystem require libcryptsetup 2.5 or newer.")
+	}
+
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512, Label: "formatLabel"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	if device.Label() != "formatLabel" || device.Subsystem() != "" {
+		test.Errorf("Unexpected label or subsystem: '%s', '%s'.", device.Label(), device.Subsystem())
+	}
+
+	err = device.SetLabel("testLabel", "testSubsystem")
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	if device.Label() != "testLabel" || device.Subsystem() != "testSubsystem" {
+		test.Errorf("Unexpected label or subsystem: '%s', '%s'.", device.Label(), device.Subsystem())
+	}
+
+	err = device.SetLabel("", "")
+	testWrapper.AssertNoError(err)
+
+	if device.Label() != "" || device.Subsystem() != "" {
+		test.Errorf("Label and subsystem should have been removed: '%s', '%s'.", device.Label(), device.Subsystem())
+	}
+}
+
+func Test_Device_SetLabel_Fails_If_Device_Is_Not_LUKS2(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.SetLabel("testLabel", "")
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	if device.Label() != "" {
+		test.Error("LUKS1 devices have no label.")
+	}
+}
+
+func Test_Device_Format_VolumeKeyBytes_VolumeKeyVerify(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	volumeKey := []byte(generateKey(512/8, test))
+	volumeKey[0] = 0
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeyBytes: volumeKey})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	storedVolumeKey, _, err := device.VolumeKeyGet(0, "testPassphrase")
+	testWrapper.AssertNoError(err)
+	if !bytes.Equal(storedVolumeKey, volumeKey) {
+		test.Error("Stored volume key should match the volume key used for formatting.")
+	}
+
+	err = device.VolumeKeyVerify(volumeKey)
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByVolumeKeyBytes("", volumeKey, 0)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_Device_Format_Fails_If_VolumeKeySize_Does_Not_Match_VolumeKeyBytes(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	volumeKey := []byte(generateKey(256/8, test))
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeyBytes: volumeKey, VolumeKeySize: 512 / 8})
+	if err != ErrVolumeKeySize {
+		test.Errorf("Expected ErrVolumeKeySize, got: %v.", err)
+	}
+
+	if device.Type() != "" {
+		test.Error("Device should not have been formatted.")
+	}
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeyBytes: volumeKey, VolumeKeySize: 256 / 8})
+	testWrapper.AssertNoError(err)
+}
+
+func Test_Device_VolumeKeyVerify_Fails_If_Volume_Key_Is_Wrong(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeyBytes: []byte(generateKey(512/8, test))})
+	testWrapper.AssertNoError(err)
+
+	wrongVolumeKey := []byte(generateKey(512/8, test))
+
+	err = device.VolumeKeyVerify(wrongVolumeKey)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -1)
+
+	err = device.ActivateByVolumeKeyBytes("", wrongVolumeKey, 0)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -1)
+}
+
+func Test_Device_VolumeKeyVerify_Fails_If_Device_Has_No_Type(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.VolumeKeyVerify([]byte(generateKey(512/8, test)))
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_Device_SetRNGType_RNGType(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	for _, rngType := range []RNGType{CRYPT_RNG_RANDOM, CRYPT_RNG_URANDOM} {
+		device.SetRNGType(rngType)
+
+		currentRNGType, err := device.RNGType()
+		testWrapper.AssertNoError(err)
+		if currentRNGType != rngType {
+			test.Errorf("RNG type should be %d, got %d.", rngType, currentRNGType)
+		}
+	}
+}
+
+func Test_Device_SetIterationTime(test *testing.T) {
+	if !pbkdfTypeSupported() {
+		test.Skip("PBKDF and DefaultPBKDF require a libcryptsetup providing crypt_get_pbkdf_type and crypt_get_pbkdf_default.")
+	}
+
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	device.SetIterationTime(100)
+
+	pbkdfType := device.PBKDF()
+	if pbkdfType == nil || pbkdfType.TimeMs != 100 {
+		test.Errorf("PBKDF time should be 100ms, got %+v.", pbkdfType)
+	}
+}
+
+func Test_Device_MemoryLock(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	if device.MemoryLock(false) {
+		test.Error("Memory should not be locked after unlocking it.")
+	}
+}
+
+// Test_SetMetadataLocking runs in a separate process, in its own directory, as metadata locking
+// can't be enabled again once disabled, and every other test expects it to be enabled.
+func Test_SetMetadataLocking(test *testing.T) {
+	if os.Getenv("GO_CRYPTSETUP_TEST_METADATA_LOCKING") != "1" {
+		executable, err := os.Executable()
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		command := exec.Command(executable, "-test.run=^Test_SetMetadataLocking$", "-test.v")
+		command.Dir = test.TempDir()
+		command.Env = append(os.Environ(), "GO_CRYPTSETUP_TEST_METADATA_LOCKING=1")
+
+		output, err := command.CombinedOutput()
+		if err != nil || !strings.Contains(string(output), "--- PASS: Test_SetMetadataLocking") {
+			test.Errorf("Test_SetMetadataLocking failed in a separate process: %v\n%s", err, output)
+		}
+
+		return
+	}
+
+	testWrapper := TestWrapper{test}
+
+	err := SetMetadataLocking(false)
+	testWrapper.AssertNoError(err)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	err = SetMetadataLocking(true)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -1)
+}
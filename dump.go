@@ -0,0 +1,368 @@
+package cryptsetup
+
+/*
+#cgo pkg-config: libcryptsetup
+#include <errno.h>
+#include <libcryptsetup.h>
+#include <stdlib.h>
+
+// crypt_dump_json was introduced in libcryptsetup 2.4, so it's declared weak
+// and checked at runtime, allowing older libraries to fall back to crypt_dump.
+int crypt_dump_json(struct crypt_device *cd, const char **json, uint32_t flags) __attribute__((weak));
+
+static int crypt_dump_json_available(void) {
+	return crypt_dump_json != NULL;
+}
+*/
+import "C"
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// HeaderInfo holds the LUKS2 metadata of a device, as stored in its JSON area.
+// Keyslots, tokens, segments and digests are indexed by their IDs.
+type HeaderInfo struct {
+	Keyslots map[int]KeyslotInfo `json:"keyslots"`
+	Tokens   map[int]TokenInfo   `json:"tokens"`
+	Segments map[int]SegmentInfo `json:"segments"`
+	Digests  map[int]DigestInfo  `json:"digests"`
+	Config   ConfigInfo          `json:"config"`
+}
+
+// KeyslotInfo describes a LUKS2 keyslot. KeySize is expressed in bytes.
+type KeyslotInfo struct {
+	Type    string      `json:"type"`
+	KeySize int         `json:"key_size"`
+	AF      KeyslotAF   `json:"af"`
+	Area    KeyslotArea `json:"area"`
+	KDF     KeyslotKDF  `json:"kdf"`
+}
+
+// KeyslotAF describes the anti-forensic splitter of a LUKS2 keyslot.
+type KeyslotAF struct {
+	Type    string `json:"type"`
+	Stripes int    `json:"stripes"`
+	Hash    string `json:"hash"`
+}
+
+// KeyslotArea describes where a LUKS2 keyslot's key material is stored. Offset and Size are expressed in bytes.
+type KeyslotArea struct {
+	Type       string `json:"type"`
+	Offset     uint64 `json:"offset,string"`
+	Size       uint64 `json:"size,string"`
+	Encryption string `json:"encryption"`
+	KeySize    int    `json:"key_size"`
+}
+
+// KeyslotKDF describes the PBKDF of a LUKS2 keyslot.
+// Hash and Iterations are set for pbkdf2, while Time, Memory and CPUs are set for argon2i and argon2id.
+type KeyslotKDF struct {
+	Type       string `json:"type"`
+	Hash       string `json:"hash"`
+	Iterations int    `json:"iterations"`
+	Time       int    `json:"time"`
+	Memory     int    `json:"memory"`
+	CPUs       int    `json:"cpus"`
+	Salt       []byte `json:"salt"`
+}
+
+// TokenInfo describes a LUKS2 token, and the keyslots it's assigned to.
+type TokenInfo struct {
+	Type     string   `json:"type"`
+	Keyslots []string `json:"keyslots"`
+}
+
+// SegmentInfo describes a LUKS2 data segment. Offset is expressed in bytes.
+// Size is either a size in bytes, or "dynamic" if the segment spans the whole device.
+type SegmentInfo struct {
+	Type       string            `json:"type"`
+	Offset     uint64            `json:"offset,string"`
+	Size       string            `json:"size"`
+	IVTweak    uint64            `json:"iv_tweak,string"`
+	Encryption string            `json:"encryption"`
+	SectorSize int               `json:"sector_size"`
+	Integrity  *SegmentIntegrity `json:"integrity,omitempty"`
+	Flags      []string          `json:"flags"`
+}
+
+// SegmentIntegrity describes the integrity protection of a LUKS2 data segment.
+type SegmentIntegrity struct {
+	Type              string `json:"type"`
+	JournalEncryption string `json:"journal_encryption"`
+	JournalIntegrity  string `json:"journal_integrity"`
+}
+
+// DigestInfo describes a LUKS2 volume key digest, and the keyslots and segments it's assigned to.
+type DigestInfo struct {
+	Type       string   `json:"type"`
+	Keyslots   []string `json:"keyslots"`
+	Segments   []string `json:"segments"`
+	Hash       string   `json:"hash"`
+	Iterations int      `json:"iterations"`
+	Salt       []byte   `json:"salt"`
+	Digest     []byte   `json:"digest"`
+}
+
+// ConfigInfo describes the LUKS2 header configuration. JSONSize and KeyslotsSize are expressed in bytes.
+type ConfigInfo struct {
+	JSONSize     uint64             `json:"json_size,string"`
+	KeyslotsSize uint64             `json:"keyslots_size,string"`
+	Flags        []string           `json:"flags"`
+	Requirements ConfigRequirements `json:"requirements"`
+}
+
+// ConfigRequirements lists the LUKS2 requirements a library must support to use the device.
+type ConfigRequirements struct {
+	Mandatory []string `json:"mandatory"`
+}
+
+// DumpJSON gets the LUKS2 metadata of a loaded device.
+// On libcryptsetup versions older than 2.4, the metadata is parsed from the header dump instead,
+// which doesn't include keyslot area and AF types, digest segments, or token data other than their keyslots.
+// On libcryptsetup 2.0, the keyslots area size, keyslot area key sizes and AF hashes aren't included either.
+// Returns a populated HeaderInfo struct on success, or an error otherwise.
+// C equivalent: crypt_dump_json
+func (device *Device) DumpJSON() (HeaderInfo, error) {
+	if C.crypt_dump_json_available() == 0 {
+		return device.dumpHeaderInfo()
+	}
+
+	var cJSON *C.char
+	if err := C.crypt_dump_json(device.cryptDevice, &cJSON, 0); err < 0 {
+		return HeaderInfo{}, &Error{functionName: "crypt_dump_json", code: int(err)}
+	}
+
+	var headerInfo HeaderInfo
+	if err := json.Unmarshal([]byte(C.GoString(cJSON)), &headerInfo); err != nil {
+		return HeaderInfo{}, err
+	}
+
+	return headerInfo, nil
+}
+
+// dumpHeaderInfo builds a HeaderInfo out of the output of crypt_dump for a LUKS2 device.
+func (device *Device) dumpHeaderInfo() (HeaderInfo, error) {
+	if device.Type() != C.CRYPT_LUKS2 {
+		return HeaderInfo{}, &Error{functionName: "crypt_dump", code: -C.EINVAL}
+	}
+
+	var cErr C.int
+	entries := device.captureLog(func() {
+		cErr = C.crypt_dump(device.cryptDevice)
+	})
+	if cErr < 0 {
+		return HeaderInfo{}, &Error{functionName: "crypt_dump", code: int(cErr)}
+	}
+
+	var dump strings.Builder
+	for _, entry := range entries {
+		if entry.level == CRYPT_LOG_NORMAL {
+			dump.WriteString(entry.message)
+		}
+	}
+
+	return parseLUKS2Dump(dump.String()), nil
+}
+
+// parseLUKS2Dump builds a HeaderInfo out of the output of crypt_dump for a LUKS2 device.
+func parseLUKS2Dump(dump string) HeaderInfo {
+	headerInfo := HeaderInfo{
+		Keyslots: make(map[int]KeyslotInfo),
+		Tokens:   make(map[int]TokenInfo),
+		Segments: make(map[int]SegmentInfo),
+		Digests:  make(map[int]DigestInfo),
+	}
+
+	section := ""
+	id := -1
+	hexField := ""
+	var hexValue []byte
+
+	for _, line := range strings.Split(dump, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		fields := strings.SplitN(trimmed, ":", 2)
+
+		// hex values, such as salts and digests, continue on the following lines
+		if len(fields) == 1 {
+			if hexField != "" {
+				hexValue = append(hexValue, parseDumpHex(trimmed)...)
+				storeDumpHex(&headerInfo, section, id, hexField, hexValue)
+			}
+			continue
+		}
+		hexField = ""
+
+		key, value := fields[0], strings.TrimSpace(fields[1])
+
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			switch key {
+			case "Data segments", "Keyslots", "Tokens", "Digests":
+				section = key
+				id = -1
+			case "Metadata area":
+				// libcryptsetup 2.0 prints the JSON area size in "bytes", later versions the whole header size in "[bytes]"
+				if strings.HasSuffix(value, " [bytes]") {
+					metadataSize, _ := strconv.ParseUint(strings.TrimSuffix(value, " [bytes]"), 10, 64)
+					if metadataSize > 4096 {
+						headerInfo.Config.JSONSize = metadataSize - 4096
+					}
+				} else {
+					headerInfo.Config.JSONSize, _ = strconv.ParseUint(strings.TrimSuffix(value, " bytes"), 10, 64)
+				}
+			case "Keyslots area":
+				headerInfo.Config.KeyslotsSize, _ = strconv.ParseUint(strings.TrimSuffix(value, " [bytes]"), 10, 64)
+			case "Flags":
+				if value != "(no flags)" {
+					headerInfo.Config.Flags = strings.Fields(value)
+				}
+			case "Requirements":
+				headerInfo.Config.Requirements.Mandatory = strings.Fields(value)
+			}
+			continue
+		}
+
+		if index, err := strconv.Atoi(key); err == nil && strings.HasPrefix(line, " ") {
+			id = index
+			switch section {
+			case "Data segments":
+				headerInfo.Segments[id] = SegmentInfo{Type: value}
+			case "Keyslots":
+				headerInfo.Keyslots[id] = KeyslotInfo{Type: value}
+			case "Tokens":
+				headerInfo.Tokens[id] = TokenInfo{Type: value}
+			case "Digests":
+				// keyslots referencing the digest were listed first
+				digest := headerInfo.Digests[id]
+				digest.Type = value
+				headerInfo.Digests[id] = digest
+			}
+			continue
+		}
+
+		if id < 0 {
+			continue
+		}
+
+		switch section {
+		case "Data segments":
+			segment := headerInfo.Segments[id]
+			switch key {
+			case "offset":
+				segment.Offset, _ = strconv.ParseUint(strings.TrimSuffix(value, " [bytes]"), 10, 64)
+			case "length":
+				segment.Size = "dynamic"
+				if value != "(whole device)" {
+					segment.Size = strings.TrimSuffix(value, " [bytes]")
+				}
+			case "cipher":
+				segment.Encryption = value
+			case "sector":
+				segment.SectorSize, _ = strconv.Atoi(strings.TrimSuffix(value, " [bytes]"))
+			case "integrity":
+				segment.Integrity = &SegmentIntegrity{Type: value}
+			case "flags":
+				segment.Flags = strings.Fields(value)
+			}
+			headerInfo.Segments[id] = segment
+
+		case "Keyslots":
+			keyslot := headerInfo.Keyslots[id]
+			switch key {
+			case "Key":
+				keyBits, _ := strconv.Atoi(strings.TrimSuffix(value, " bits"))
+				keyslot.KeySize = keyBits / 8
+			case "Cipher":
+				keyslot.Area.Encryption = value
+			case "Cipher key":
+				keyBits, _ := strconv.Atoi(strings.TrimSuffix(value, " bits"))
+				keyslot.Area.KeySize = keyBits / 8
+			case "PBKDF":
+				keyslot.KDF.Type = value
+			case "Hash":
+				keyslot.KDF.Hash = value
+			case "Iterations":
+				keyslot.KDF.Iterations, _ = strconv.Atoi(value)
+			case "Time cost":
+				keyslot.KDF.Time, _ = strconv.Atoi(value)
+			case "Memory":
+				keyslot.KDF.Memory, _ = strconv.Atoi(value)
+			case "Threads":
+				keyslot.KDF.CPUs, _ = strconv.Atoi(value)
+			case "Salt":
+				keyslot.KDF.Salt = parseDumpHex(value)
+				hexField, hexValue = key, keyslot.KDF.Salt
+			case "AF stripes":
+				keyslot.AF.Stripes, _ = strconv.Atoi(value)
+			case "AF hash":
+				keyslot.AF.Hash = value
+			case "Area offset":
+				keyslot.Area.Offset, _ = strconv.ParseUint(strings.TrimSuffix(value, " [bytes]"), 10, 64)
+			case "Area length":
+				keyslot.Area.Size, _ = strconv.ParseUint(strings.TrimSuffix(value, " [bytes]"), 10, 64)
+			case "Digest ID":
+				if digestID, err := strconv.Atoi(value); err == nil {
+					digest := headerInfo.Digests[digestID]
+					digest.Keyslots = append(digest.Keyslots, strconv.Itoa(id))
+					headerInfo.Digests[digestID] = digest
+				}
+			}
+			headerInfo.Keyslots[id] = keyslot
+
+		case "Tokens":
+			token := headerInfo.Tokens[id]
+			if key == "Keyslot" {
+				token.Keyslots = append(token.Keyslots, value)
+			}
+			headerInfo.Tokens[id] = token
+
+		case "Digests":
+			digest := headerInfo.Digests[id]
+			switch key {
+			case "Hash":
+				digest.Hash = value
+			case "Iterations":
+				digest.Iterations, _ = strconv.Atoi(value)
+			case "Salt":
+				digest.Salt = parseDumpHex(value)
+				hexField, hexValue = key, digest.Salt
+			case "Digest":
+				digest.Digest = parseDumpHex(value)
+				hexField, hexValue = key, digest.Digest
+			}
+			headerInfo.Digests[id] = digest
+		}
+	}
+
+	return headerInfo
+}
+
+// parseDumpHex parses a line of space separated hex bytes, as printed by crypt_dump.
+func parseDumpHex(value string) []byte {
+	decoded, _ := hex.DecodeString(strings.Join(strings.Fields(value), ""))
+	return decoded
+}
+
+// storeDumpHex stores a hex value spanning several lines of crypt_dump output back into 'headerInfo'.
+func storeDumpHex(headerInfo *HeaderInfo, section string, id int, field string, value []byte) {
+	switch section {
+	case "Keyslots":
+		keyslot := headerInfo.Keyslots[id]
+		keyslot.KDF.Salt = value
+		headerInfo.Keyslots[id] = keyslot
+	case "Digests":
+		digest := headerInfo.Digests[id]
+		if field == "Salt" {
+			digest.Salt = value
+		} else {
+			digest.Digest = value
+		}
+		headerInfo.Digests[id] = digest
+	}
+}
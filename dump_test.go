@@ -0,0 +1,344 @@
+package cryptsetup
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// luks2Dump202 follows the crypt_dump output format of libcryptsetup 2.0.2, which prints the JSON area size as "Metadata area",
+// and neither the keyslots area size, the keyslot area key size nor the AF hash.
+const luks2Dump202 string = `LUKS header information
+Version:       	2
+Epoch:         	3
+Metadata area: 	12288 bytes
+UUID:          	5f8c2a4e-3b1d-4c6f-9a7e-2d4b6c8e0a1f
+Label:         	(no label)
+Subsystem:     	(no subsystem)
+Flags:       	(no flags)
+
+Data segments:
+  0: crypt
+	offset: 4194304 [bytes]
+	length: (whole device)
+	cipher: aes-xts-plain64
+	sector: 512 [bytes]
+
+Keyslots:
+  0: luks2
+	Key:        512 bits
+	Priority:   normal
+	Cipher:     aes-xts-plain64
+	PBKDF:      argon2i
+	Time cost:  4
+	Memory:     645763
+	Threads:    2
+	Salt:       8d 2c 5e 71 0b 9a 44 e3 6f 12 c8 3d a9 57 b0 1e 
+	            42 f6 9d 08 e5 7b 3a c1 64 2f 90 d8 1b 5c a7 33 
+	AF stripes: 4000
+	Area offset:32768 [bytes]
+	Area length:258048 [bytes]
+	Digest ID:  0
+Tokens:
+Digests:
+  0: pbkdf2
+	Hash:       sha256
+	Iterations: 98642
+	Salt:       c3 19 7e 5a 20 d4 8b 6f 93 e1 0c 57 b2 4a f8 16 
+	            7d 05 ac 39 e6 82 5b 1f c0 74 2e 9b 63 d8 a1 4c 
+	Digest:     1a 6e 93 c7 52 0f b8 2d 74 e5 39 a0 16 cb 84 5f 
+	            e2 07 9c 4b 31 d6 68 f0 8a 25 bd 43 07 7e c9 12 
+`
+
+// luks2Dump222 follows the crypt_dump output format of libcryptsetup 2.2.2.
+const luks2Dump222 string = `LUKS header information
+Version:       	2
+Epoch:         	5
+Metadata area: 	16384 [bytes]
+Keyslots area: 	16744448 [bytes]
+UUID:          	a7d31f60-8e2b-4c95-b1d4-6f0e3c2a9b58
+Label:         	(no label)
+Subsystem:     	(no subsystem)
+Flags:       	allow-discards 
+
+Data segments:
+  0: crypt
+	offset: 16777216 [bytes]
+	length: (whole device)
+	cipher: aes-xts-plain64
+	sector: 4096 [bytes]
+
+Keyslots:
+  0: luks2
+	Key:        512 bits
+	Priority:   normal
+	Cipher:     aes-xts-plain64
+	Cipher key: 512 bits
+	PBKDF:      pbkdf2
+	Hash:       sha256
+	Iterations: 1000
+	Salt:       35 6c 68 cd 4e 12 0e bc c0 0b 87 9f 41 87 e0 9e 
+	            fd 8c 33 c3 5e 85 10 9b 0f f0 b6 0d 38 19 2e a0 
+	AF stripes: 4000
+	AF hash:    sha256
+	Area offset:32768 [bytes]
+	Area length:258048 [bytes]
+	Digest ID:  0
+  1: luks2
+	Key:        512 bits
+	Priority:   normal
+	Cipher:     aes-xts-plain64
+	Cipher key: 512 bits
+	PBKDF:      argon2id
+	Time cost:  4
+	Memory:     32768
+	Threads:    1
+	Salt:       1f 6b f9 17 80 5d a3 bf 6a ca 8f cf 6d 6d 88 f7 
+	            4a a8 bd d5 9f 3a 01 82 89 a6 65 71 7c 7e 47 99 
+	AF stripes: 4000
+	AF hash:    sha256
+	Area offset:290816 [bytes]
+	Area length:258048 [bytes]
+	Digest ID:  0
+Tokens:
+  0: luks2-keyring
+	Key description: testKey
+	Keyslot:  1
+Digests:
+  0: pbkdf2
+	Hash:       sha256
+	Iterations: 1000
+	Salt:       f4 95 8e 0e 52 68 49 35 d4 92 ef 8a df 4e 13 ea 
+	            e5 99 b3 6a 45 b2 f6 bd 41 db e7 8e 49 89 0d f2 
+	Digest:     d6 8c 83 d7 ad 4d 87 b8 72 5c 56 84 cc 36 24 6a 
+	            37 2d 74 94 2d d7 15 76 38 08 db 50 8b e2 ec b0 
+`
+
+func Test_Dump_DumpJSON(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	pbkdfType := PbkdfType{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 4096, PBKDFType: &pbkdfType}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(3, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	headerInfo, err := device.DumpJSON()
+	testWrapper.AssertNoError(err)
+
+	if len(headerInfo.Keyslots) != 2 || len(headerInfo.Tokens) != 0 || len(headerInfo.Segments) != 1 || len(headerInfo.Digests) != 1 {
+		test.Fatalf("Unexpected header contents: %+v.", headerInfo)
+	}
+
+	keyslot := headerInfo.Keyslots[3]
+	if keyslot.Type != "luks2" || keyslot.KeySize != 512/8 || keyslot.KDF.Type != "pbkdf2" || keyslot.KDF.Hash != "sha256" || len(keyslot.KDF.Salt) == 0 {
+		test.Errorf("Unexpected keyslot: %+v.", keyslot)
+	}
+
+	if keyslot.Area.Encryption != "aes-xts-plain64" || keyslot.Area.Offset == 0 || keyslot.Area.Size == 0 {
+		test.Errorf("Unexpected keyslot area: %+v.", keyslot.Area)
+	}
+
+	segment := headerInfo.Segments[0]
+	if segment.Type != "crypt" || segment.Size != "dynamic" || segment.SectorSize != 4096 || segment.Encryption != "aes-xts-plain64" {
+		test.Errorf("Unexpected segment: %+v.", segment)
+	}
+
+	digest := headerInfo.Digests[0]
+	if !reflect.DeepEqual(digest.Keyslots, []string{"0", "3"}) || !reflect.DeepEqual(digest.Segments, []string{"0"}) || len(digest.Digest) == 0 {
+		test.Errorf("Unexpected digest: %+v.", digest)
+	}
+
+	metadataSize, keyslotsSize, err := device.MetadataSize()
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+
+	if headerInfo.Config.JSONSize != metadataSize-4096 || headerInfo.Config.KeyslotsSize != keyslotsSize {
+		test.Errorf("Unexpected config: %+v.", headerInfo.Config)
+	}
+}
+
+func Test_Dump_DumpJSON_Matches_Dump_Fallback(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	pbkdfType := PbkdfType{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 4096, PBKDFType: &pbkdfType}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(3, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	headerInfo, err := device.DumpJSON()
+	testWrapper.AssertNoError(err)
+
+	fallbackHeaderInfo, err := device.dumpHeaderInfo()
+	testWrapper.AssertNoError(err)
+
+	for id, keyslot := range headerInfo.Keyslots {
+		fallbackKeyslot := fallbackHeaderInfo.Keyslots[id]
+
+		if fallbackKeyslot.Type != keyslot.Type || fallbackKeyslot.KeySize != keyslot.KeySize {
+			test.Errorf("Keyslot %d differs: %+v, %+v.", id, keyslot, fallbackKeyslot)
+		}
+
+		if fallbackKeyslot.AF.Stripes != keyslot.AF.Stripes || fallbackKeyslot.AF.Hash != keyslot.AF.Hash {
+			test.Errorf("Keyslot %d AF differs: %+v, %+v.", id, keyslot.AF, fallbackKeyslot.AF)
+		}
+
+		fallbackKeyslot.Area.Type = keyslot.Area.Type
+		if fallbackKeyslot.Area != keyslot.Area {
+			test.Errorf("Keyslot %d area differs: %+v, %+v.", id, keyslot.Area, fallbackKeyslot.Area)
+		}
+
+		if !reflect.DeepEqual(fallbackKeyslot.KDF, keyslot.KDF) {
+			test.Errorf("Keyslot %d KDF differs: %+v, %+v.", id, keyslot.KDF, fallbackKeyslot.KDF)
+		}
+	}
+
+	fallbackSegment := fallbackHeaderInfo.Segments[0]
+	segment := headerInfo.Segments[0]
+	if fallbackSegment.Type != segment.Type || fallbackSegment.Offset != segment.Offset || fallbackSegment.Size != segment.Size ||
+		fallbackSegment.Encryption != segment.Encryption || fallbackSegment.SectorSize != segment.SectorSize {
+		test.Errorf("Segment differs: %+v, %+v.", segment, fallbackSegment)
+	}
+
+	fallbackDigest := fallbackHeaderInfo.Digests[0]
+	digest := headerInfo.Digests[0]
+	if fallbackDigest.Type != digest.Type || fallbackDigest.Hash != digest.Hash || fallbackDigest.Iterations != digest.Iterations ||
+		!bytes.Equal(fallbackDigest.Salt, digest.Salt) || !bytes.Equal(fallbackDigest.Digest, digest.Digest) ||
+		!reflect.DeepEqual(fallbackDigest.Keyslots, digest.Keyslots) {
+		test.Errorf("Digest differs: %+v, %+v.", digest, fallbackDigest)
+	}
+
+	if fallbackHeaderInfo.Config.JSONSize != headerInfo.Config.JSONSize || fallbackHeaderInfo.Config.KeyslotsSize != headerInfo.Config.KeyslotsSize {
+		test.Errorf("Config differs: %+v, %+v.", headerInfo.Config, fallbackHeaderInfo.Config)
+	}
+}
+
+func Test_Dump_DumpJSON_Fails_If_Device_Is_Not_LUKS2(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	_, err = device.DumpJSON()
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	_, err = device.dumpHeaderInfo()
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_Dump_parseLUKS2Dump_202(test *testing.T) {
+	headerInfo := parseLUKS2Dump(luks2Dump202)
+
+	if len(headerInfo.Keyslots) != 1 || len(headerInfo.Tokens) != 0 || len(headerInfo.Segments) != 1 || len(headerInfo.Digests) != 1 {
+		test.Fatalf("Unexpected header contents: %+v.", headerInfo)
+	}
+
+	if headerInfo.Config.JSONSize != 12288 || headerInfo.Config.KeyslotsSize != 0 || len(headerInfo.Config.Flags) != 0 {
+		test.Errorf("Unexpected config: %+v.", headerInfo.Config)
+	}
+
+	segment := headerInfo.Segments[0]
+	if segment.Type != "crypt" || segment.Offset != 4194304 || segment.Size != "dynamic" || segment.Encryption != "aes-xts-plain64" || segment.SectorSize != 512 {
+		test.Errorf("Unexpected segment: %+v.", segment)
+	}
+
+	keyslot := headerInfo.Keyslots[0]
+	expectedKDF := KeyslotKDF{Type: "argon2i", Time: 4, Memory: 645763, CPUs: 2, Salt: dumpTestHex("8d2c5e710b9a44e36f12c83da957b01e42f69d08e57b3ac1642f90d81b5ca733", test)}
+	if keyslot.Type != "luks2" || keyslot.KeySize != 512/8 || !reflect.DeepEqual(keyslot.KDF, expectedKDF) {
+		test.Errorf("Unexpected keyslot: %+v.", keyslot)
+	}
+
+	if keyslot.AF.Stripes != 4000 || keyslot.AF.Hash != "" {
+		test.Errorf("Unexpected keyslot AF: %+v.", keyslot.AF)
+	}
+
+	if keyslot.Area != (KeyslotArea{Offset: 32768, Size: 258048, Encryption: "aes-xts-plain64"}) {
+		test.Errorf("Unexpected keyslot area: %+v.", keyslot.Area)
+	}
+
+	digest := headerInfo.Digests[0]
+	if digest.Type != "pbkdf2" || digest.Hash != "sha256" || digest.Iterations != 98642 || !reflect.DeepEqual(digest.Keyslots, []string{"0"}) ||
+		!bytes.Equal(digest.Salt, dumpTestHex("c3197e5a20d48b6f93e10c57b24af8167d05ac39e6825b1fc0742e9b63d8a14c", test)) ||
+		!bytes.Equal(digest.Digest, dumpTestHex("1a6e93c7520fb82d74e539a016cb845fe2079c4b31d668f08a25bd43077ec912", test)) {
+		test.Errorf("Unexpected digest: %+v.", digest)
+	}
+}
+
+func Test_Dump_parseLUKS2Dump_222(test *testing.T) {
+	headerInfo := parseLUKS2Dump(luks2Dump222)
+
+	if len(headerInfo.Keyslots) != 2 || len(headerInfo.Tokens) != 1 || len(headerInfo.Segments) != 1 || len(headerInfo.Digests) != 1 {
+		test.Fatalf("Unexpected header contents: %+v.", headerInfo)
+	}
+
+	if headerInfo.Config.JSONSize != 12288 || headerInfo.Config.KeyslotsSize != 16744448 || !reflect.DeepEqual(headerInfo.Config.Flags, []string{"allow-discards"}) {
+		test.Errorf("Unexpected config: %+v.", headerInfo.Config)
+	}
+
+	segment := headerInfo.Segments[0]
+	if segment.Type != "crypt" || segment.Offset != 16777216 || segment.Size != "dynamic" || segment.Encryption != "aes-xts-plain64" || segment.SectorSize != 4096 {
+		test.Errorf("Unexpected segment: %+v.", segment)
+	}
+
+	keyslot := headerInfo.Keyslots[0]
+	expectedKDF := KeyslotKDF{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Salt: dumpTestHex("356c68cd4e120ebcc00b879f4187e09efd8c33c35e85109b0ff0b60d38192ea0", test)}
+	if keyslot.Type != "luks2" || keyslot.KeySize != 512/8 || !reflect.DeepEqual(keyslot.KDF, expectedKDF) {
+		test.Errorf("Unexpected keyslot 0: %+v.", keyslot)
+	}
+
+	keyslot = headerInfo.Keyslots[1]
+	expectedKDF = KeyslotKDF{Type: "argon2id", Time: 4, Memory: 32768, CPUs: 1, Salt: dumpTestHex("1f6bf917805da3bf6aca8fcf6d6d88f74aa8bdd59f3a018289a665717c7e4799", test)}
+	if !reflect.DeepEqual(keyslot.KDF, expectedKDF) || keyslot.AF.Stripes != 4000 || keyslot.AF.Hash != "sha256" {
+		test.Errorf("Unexpected keyslot 1: %+v.", keyslot)
+	}
+
+	if keyslot.Area != (KeyslotArea{Offset: 290816, Size: 258048, Encryption: "aes-xts-plain64", KeySize: 512 / 8}) {
+		test.Errorf("Unexpected keyslot 1 area: %+v.", keyslot.Area)
+	}
+
+	token := headerInfo.Tokens[0]
+	if token.Type != "luks2-keyring" || !reflect.DeepEqual(token.Keyslots, []string{"1"}) {
+		test.Errorf("Unexpected token: %+v.", token)
+	}
+
+	digest := headerInfo.Digests[0]
+	if digest.Type != "pbkdf2" || digest.Iterations != 1000 || !reflect.DeepEqual(digest.Keyslots, []string{"0", "1"}) ||
+		!bytes.Equal(digest.Digest, dumpTestHex("d68c83d7ad4d87b8725c5684cc36246a372d74942dd715763808db508be2ecb0", test)) {
+		test.Errorf("Unexpected digest: %+v.", digest)
+	}
+}
+
+func dumpTestHex(value string, test *testing.T) []byte {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return decoded
+}
@@ -1,6 +1,43 @@
 package cryptsetup
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidHeaderBackup is returned when a LUKS header backup is truncated, or doesn't start with a LUKS header.
+var ErrInvalidHeaderBackup = errors.New("invalid LUKS header backup")
+
+// ErrConvertUnsupportedPBKDF is returned when converting to LUKS1 a device with keyslots using a PBKDF other than pbkdf2.
+var ErrConvertUnsupportedPBKDF = errors.New("keyslots using a PBKDF other than pbkdf2 can't be converted to LUKS1")
+
+// ErrConvertTokens is returned when converting to LUKS1 a device with tokens, as LUKS1 doesn't support them.
+var ErrConvertTokens = errors.New("tokens would be lost when converting to LUKS1")
+
+// ErrConvertIntegrity is returned when converting to LUKS1 a device using authenticated encryption, as LUKS1 doesn't support it.
+var ErrConvertIntegrity = errors.New("integrity protection would be lost when converting to LUKS1")
+
+// ErrNoIntegrity is returned when formatting a LUKS2 device using authenticated encryption without an integrity algorithm.
+var ErrNoIntegrity = errors.New("authenticated encryption requires an integrity algorithm")
+
+// ErrVolumeKeySize is returned when formatting a device using a binary volume key whose length doesn't match the volume key size.
+var ErrVolumeKeySize = errors.New("volume key size doesn't match the length of the volume key")
+
+// RestoreError is returned when an operation fails, and restoring the device to its previous state fails as well.
+// Err is the error the operation failed with, and RestoreErr the error restoring the device failed with.
+type RestoreError struct {
+	Err        error
+	RestoreErr error
+}
+
+func (e *RestoreError) Error() string {
+	return fmt.Sprintf("%s Restoring the device failed as well: %s", e.Err.Error(), e.RestoreErr.Error())
+}
+
+// Unwrap returns the error the operation failed with.
+func (e *RestoreError) Unwrap() error {
+	return e.Err
+}
 
 // Error holds the name and the return value of a libcryptsetup function that was executed with an error.
 type Error struct {
@@ -0,0 +1,38 @@
+package cryptsetup
+
+/*
+#cgo pkg-config: libcryptsetup
+#include <libcryptsetup.h>
+
+// FVAULT2 support was introduced in libcryptsetup 2.6, along with keyslot contexts,
+// so crypt_keyslot_context_free is declared weak and checked at runtime to detect it.
+struct crypt_keyslot_context;
+void crypt_keyslot_context_free(struct crypt_keyslot_context *kc) __attribute__((weak));
+
+static int fvault2_supported(void) {
+	return crypt_keyslot_context_free != NULL;
+}
+*/
+import "C"
+import "unsafe"
+
+// FVAULT2 is the struct used to manipulate Apple FileVault2 devices.
+// These devices can only be loaded, and once loaded they're activated using ActivateByPassphrase().
+// Requires libcryptsetup 2.6 or newer.
+type FVAULT2 struct{}
+
+// Name returns the FVAULT2 device type name as a string.
+func (fvault2 FVAULT2) Name() string {
+	return "FVAULT2"
+}
+
+// Unmanaged is used to specialize FVAULT2.
+// FVAULT2 devices don't take any type-specific parameters.
+func (fvault2 FVAULT2) Unmanaged() (unsafe.Pointer, func()) {
+	return nil, func() {}
+}
+
+// fvault2Supported reports whether the loaded libcryptsetup supports FVAULT2 devices.
+func fvault2Supported() bool {
+	return C.fvault2_supported() != 0
+}
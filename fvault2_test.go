@@ -0,0 +1,226 @@
+package cryptsetup
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+const fvault2BlockSize = 4096
+const fvault2MetadataBlockSize = 8192
+
+// createFVAULT2Image writes a minimal FileVault2 Core Storage volume, unlocked by 'passphrase', to 'path'.
+// It only holds the structures libcryptsetup reads: the volume header, the disk label,
+// the volume groups descriptor, and the encrypted metadata blocks describing the keys and the logical volume.
+func createFVAULT2Image(path string, passphrase string, test *testing.T) {
+	metadataKey := randomBytes(aes.BlockSize, test)
+	physicalVolumeUUID := randomBytes(16, test)
+	familyUUID := randomBytes(16, test)
+	passphraseSalt := randomBytes(16, test)
+	keyEncryptingKey := randomBytes(aes.BlockSize, test)
+	volumeKey := randomBytes(aes.BlockSize, test)
+	iterations := uint32(1000)
+
+	image := make([]byte, 16*fvault2BlockSize)
+
+	// Volume header, pointing to the disk label in block 1.
+	header := image[:512]
+	binary.LittleEndian.PutUint16(header[0x08:], 1)
+	binary.LittleEndian.PutUint16(header[0x0a:], 0x10)
+	binary.LittleEndian.PutUint16(header[0x58:], 0x5343)
+	binary.LittleEndian.PutUint32(header[0x5c:], 1)
+	binary.LittleEndian.PutUint32(header[0x60:], fvault2BlockSize)
+	binary.LittleEndian.PutUint64(header[0x68:], 1)
+	binary.LittleEndian.PutUint32(header[0xa8:], aes.BlockSize)
+	binary.LittleEndian.PutUint32(header[0xac:], 2)
+	copy(header[0xb0:], metadataKey)
+	copy(header[0x130:], physicalVolumeUUID)
+	fvault2Checksum(header)
+
+	// Disk label, followed by the volume groups descriptor, pointing to 3 encrypted metadata blocks in block 4.
+	diskLabel := image[fvault2BlockSize : fvault2BlockSize+fvault2MetadataBlockSize]
+	binary.LittleEndian.PutUint16(diskLabel[0x08:], 1)
+	binary.LittleEndian.PutUint16(diskLabel[0x0a:], 0x11)
+	binary.LittleEndian.PutUint32(diskLabel[0xdc:], fvault2MetadataBlockSize)
+	fvault2Checksum(diskLabel)
+
+	volumeGroupsDescriptor := image[fvault2BlockSize+fvault2MetadataBlockSize:]
+	binary.LittleEndian.PutUint64(volumeGroupsDescriptor[0x08:], 3)
+	binary.LittleEndian.PutUint64(volumeGroupsDescriptor[0x20:], 4)
+
+	// Keys: the passphrase wraps the key encrypting key, which wraps the volume key.
+	passphraseKey := pbkdf2(sha256.New, []byte(passphrase), passphraseSalt, int(iterations), aes.BlockSize)
+
+	passphraseWrappedKEK := make([]byte, 284)
+	copy(passphraseWrappedKEK[0x08:], passphraseSalt)
+	copy(passphraseWrappedKEK[0x20:], aesKeyWrap(passphraseKey, keyEncryptingKey, test))
+	binary.LittleEndian.PutUint32(passphraseWrappedKEK[0xa8:], iterations)
+
+	kekWrappedVolumeKey := make([]byte, 256)
+	copy(kekWrappedVolumeKey[0x08:], aesKeyWrap(keyEncryptingKey, volumeKey, test))
+
+	keysBlock := fvault2MetadataBlock(0x0019, 0x70, fmt.Sprintf(
+		"<dict><key>PassphraseWrappedKEKStruct</key><data>%s</data><key>KEKWrappedVolumeKeyStruct</key><data>%s</data></dict>",
+		base64.StdEncoding.EncodeToString(passphraseWrappedKEK),
+		base64.StdEncoding.EncodeToString(kekWrappedVolumeKey),
+	))
+
+	logicalVolumeBlock := fvault2MetadataBlock(0x001a, 0x80, fmt.Sprintf(
+		"<dict><key>com.apple.corestorage.lv.size</key><integer size=\"64\">0x%x</integer><key>com.apple.corestorage.lv.familyUUID</key><string>%X-%X-%X-%X-%X</string></dict>",
+		1024*1024, familyUUID[0:4], familyUUID[4:6], familyUUID[6:8], familyUUID[8:10], familyUUID[10:16],
+	))
+
+	// The logical volume starts in block 8.
+	offsetBlock := fvault2MetadataBlock(0x0305, 0, "")
+	binary.LittleEndian.PutUint32(offsetBlock[0x68:], 8)
+	fvault2Checksum(offsetBlock)
+
+	for index, block := range [][]byte{keysBlock, logicalVolumeBlock, offsetBlock} {
+		offset := 4*fvault2BlockSize + index*fvault2MetadataBlockSize
+		copy(image[offset:], block)
+		encryptAESXTS(append(metadataKey, physicalVolumeUUID...), image[offset:offset+fvault2MetadataBlockSize], uint64(index), test)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteAt(image, 0); err != nil {
+		test.Fatal(err)
+	}
+}
+
+// fvault2MetadataBlock builds a Core Storage metadata block of type 'blockType', holding 'xml'.
+// The offset and size of the XML are stored at 'xmlField', unless it's 0.
+func fvault2MetadataBlock(blockType uint16, xmlField int, xml string) []byte {
+	block := make([]byte, fvault2MetadataBlockSize)
+	binary.LittleEndian.PutUint16(block[0x08:], 1)
+	binary.LittleEndian.PutUint16(block[0x0a:], blockType)
+	binary.LittleEndian.PutUint32(block[0x30:], fvault2MetadataBlockSize)
+
+	if xmlField != 0 {
+		binary.LittleEndian.PutUint32(block[xmlField:], 0x100)
+		binary.LittleEndian.PutUint32(block[xmlField+4:], uint32(len(xml)))
+		copy(block[0x100:], xml)
+	}
+
+	fvault2Checksum(block)
+
+	return block
+}
+
+// fvault2Checksum stores the CRC32C checksum of a Core Storage block in its first 8 bytes, along with its seed.
+func fvault2Checksum(block []byte) {
+	binary.LittleEndian.PutUint32(block[4:], 0xffffffff)
+	binary.LittleEndian.PutUint32(block[0:], ^crc32.Checksum(block[8:], crc32.MakeTable(crc32.Castagnoli)))
+}
+
+// aesKeyWrap wraps 'key' using 'kek', as specified by RFC 3394.
+func aesKeyWrap(kek []byte, key []byte, test *testing.T) []byte {
+	kekCipher, err := aes.NewCipher(kek)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	wrapped := make([]byte, 8+len(key))
+	binary.BigEndian.PutUint64(wrapped, 0xa6a6a6a6a6a6a6a6)
+	copy(wrapped[8:], key)
+
+	blocks := len(key) / 8
+	block := make([]byte, aes.BlockSize)
+	for round := 0; round < 6; round++ {
+		for index := 1; index <= blocks; index++ {
+			copy(block, wrapped[:8])
+			copy(block[8:], wrapped[index*8:index*8+8])
+			kekCipher.Encrypt(block, block)
+
+			binary.BigEndian.PutUint64(wrapped, binary.BigEndian.Uint64(block)^uint64(blocks*round+index))
+			copy(wrapped[index*8:], block[8:])
+		}
+	}
+
+	return wrapped
+}
+
+func randomBytes(size int, test *testing.T) []byte {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		test.Fatal(err)
+	}
+
+	return bytes
+}
+
+func Test_FVAULT2_Load_ActivateByPassphrase_Deactivate(test *testing.T) {
+	if !fvault2Supported() {
+		test.Skip("FVAULT2 requires libcryptsetup 2.6 or newer.")
+	}
+
+	testWrapper := TestWrapper{test}
+
+	createFVAULT2Image(DevicePath, "testPassphrase", test)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(FVAULT2{})
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "FVAULT2" {
+		test.Errorf("Expected type: FVAULT2, got: %s", device.Type())
+	}
+
+	err = device.ActivateByPassphrase(DeviceName, CRYPT_ANY_SLOT, "testPassphrase", CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertNoError(err)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_FVAULT2_ActivateByPassphrase_Checks_Passphrase(test *testing.T) {
+	if !fvault2Supported() {
+		test.Skip("FVAULT2 requires libcryptsetup 2.6 or newer.")
+	}
+
+	testWrapper := TestWrapper{test}
+
+	createFVAULT2Image(DevicePath, "testPassphrase", test)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(FVAULT2{})
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByPassphrase("", CRYPT_ANY_SLOT, "testPassphrase", 0)
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByPassphrase("", CRYPT_ANY_SLOT, "wrongPassphrase", 0)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -1)
+}
+
+func Test_FVAULT2_Load_Fails_If_Device_Is_Not_FVAULT2(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.Load(FVAULT2{})
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
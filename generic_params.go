@@ -1,10 +1,13 @@
 package cryptsetup
 
 // GenericParams are device type independent parameters that are used to manipulate devices in various ways.
+// VolumeKeyBytes takes precedence over VolumeKey, and if VolumeKeySize is zero, its length is used as the volume key size.
+// Otherwise, VolumeKeySize must match the length of VolumeKeyBytes.
 type GenericParams struct {
-	Cipher        string
-	CipherMode    string
-	UUID          string
-	VolumeKey     string
-	VolumeKeySize int
+	Cipher         string
+	CipherMode     string
+	UUID           string
+	VolumeKey      string
+	VolumeKeyBytes []byte
+	VolumeKeySize  int
 }
@@ -0,0 +1,38 @@
+package cryptsetup
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// luksMagic is the magic both LUKS1 and LUKS2 headers start with.
+var luksMagic = []byte{'L', 'U', 'K', 'S', 0xba, 0xbe}
+
+// headerBackupMinSize is the size of the smallest valid LUKS header backup, a LUKS2 binary header and its JSON area.
+const headerBackupMinSize = 16 * 1024
+
+// checkHeaderBackup checks that 'file' holds a plausible LUKS header backup,
+// and rewinds it so it can be read from the beginning.
+func checkHeaderBackup(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() < headerBackupMinSize || info.Size()%512 != 0 {
+		return ErrInvalidHeaderBackup
+	}
+
+	magic := make([]byte, len(luksMagic))
+	if _, err := file.ReadAt(magic, 0); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(magic, luksMagic) {
+		return ErrInvalidHeaderBackup
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	return err
+}
@@ -0,0 +1,155 @@
+package cryptsetup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func eraseHeader(test *testing.T) {
+	file, err := os.OpenFile(DevicePath, os.O_WRONLY, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteAt(make([]byte, 64*1024), 0); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func Test_Header_HeaderBackup_HeaderRestore(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	uuid := device.GetUUID()
+
+	backupFile := filepath.Join(test.TempDir(), "header")
+
+	err = device.HeaderBackup(backupFile)
+	testWrapper.AssertNoError(err)
+
+	eraseHeader(test)
+	testWrapper.AssertError(device.Load(nil))
+
+	err = device.HeaderRestore(backupFile)
+	testWrapper.AssertNoError(err)
+
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	if device.GetUUID() != uuid {
+		test.Errorf("UUID should be '%s', but '%s' was returned instead.", uuid, device.GetUUID())
+	}
+}
+
+func Test_Header_HeaderBackup_Fails_If_File_Exists(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	backupFile := filepath.Join(test.TempDir(), "header")
+	if err := os.WriteFile(backupFile, []byte("existing"), 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	err = device.HeaderBackup(backupFile)
+	testWrapper.AssertError(err)
+
+	contents, err := os.ReadFile(backupFile)
+	testWrapper.AssertNoError(err)
+	if string(contents) != "existing" {
+		test.Error("Existing file should not have been overwritten.")
+	}
+}
+
+func Test_Header_HeaderBackupTo_HeaderRestoreFrom(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	uuid := device.GetUUID()
+
+	var backup bytes.Buffer
+	written, err := device.HeaderBackupTo(&backup)
+	testWrapper.AssertNoError(err)
+
+	if written != int64(backup.Len()) || written < headerBackupMinSize {
+		test.Errorf("Unexpected header backup size: %d bytes written, %d bytes buffered.", written, backup.Len())
+	}
+
+	eraseHeader(test)
+
+	err = device.HeaderRestoreFrom(&backup)
+	testWrapper.AssertNoError(err)
+
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	if device.GetUUID() != uuid {
+		test.Errorf("UUID should be '%s', but '%s' was returned instead.", uuid, device.GetUUID())
+	}
+}
+
+func Test_Header_HeaderBackupTo_Fails_If_Device_Has_No_Header(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	eraseHeader(test)
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	var backup bytes.Buffer
+	_, err = device.HeaderBackupTo(&backup)
+	testWrapper.AssertError(err)
+
+	if backup.Len() != 0 {
+		test.Error("Nothing should have been written.")
+	}
+}
+
+func Test_Header_HeaderRestoreFrom_Fails_If_Backup_Is_Invalid(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.HeaderRestoreFrom(bytes.NewReader(make([]byte, headerBackupMinSize)))
+	if err != ErrInvalidHeaderBackup {
+		test.Errorf("Expected ErrInvalidHeaderBackup for a backup without LUKS magic, got: %v.", err)
+	}
+
+	err = device.HeaderRestoreFrom(bytes.NewReader(luksMagic))
+	if err != ErrInvalidHeaderBackup {
+		test.Errorf("Expected ErrInvalidHeaderBackup for a truncated backup, got: %v.", err)
+	}
+
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+}
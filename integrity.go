@@ -0,0 +1,198 @@
+package cryptsetup
+
+/*
+#cgo pkg-config: libcryptsetup
+#include <libcryptsetup.h>
+#include <stdlib.h>
+
+// Activation flags introduced after libcryptsetup 2.0, which the installed headers define.
+// Older versions ignore these flags, and activate the device in journal mode instead.
+static uint32_t integrity_supported_flags(void) {
+	uint32_t flags = 0;
+#ifdef CRYPT_ACTIVATE_RECALCULATE
+	flags |= CRYPT_ACTIVATE_RECALCULATE;
+#endif
+#ifdef CRYPT_ACTIVATE_NO_JOURNAL_BITMAP
+	flags |= CRYPT_ACTIVATE_NO_JOURNAL_BITMAP;
+#endif
+#ifdef CRYPT_ACTIVATE_RECALCULATE_RESET
+	flags |= CRYPT_ACTIVATE_RECALCULATE_RESET;
+#endif
+	return flags;
+}
+*/
+import "C"
+import "unsafe"
+
+// Integrity is the struct used to manipulate standalone dm-integrity devices.
+// For keyed integrity algorithms, the integrity key is provided as the volume key.
+type Integrity struct {
+	IntegrityParams
+}
+
+type IntegrityParams struct {
+	JournalSize       uint64
+	JournalWatermark  uint
+	JournalCommitTime uint
+
+	InterleaveSectors uint32
+	TagSize           uint32
+	SectorSize        uint32
+	BufferSectors     uint32
+
+	Integrity        string
+	IntegrityKeySize uint32
+
+	JournalIntegrity        string
+	JournalIntegrityKey     string
+	JournalIntegrityKeySize uint32
+
+	JournalCrypt        string
+	JournalCryptKey     string
+	JournalCryptKeySize uint32
+}
+
+// IntegrityMode selects how an Integrity device protects writes.
+type IntegrityMode int
+
+const (
+	// IntegrityModeJournal writes data and tags through the journal. This is the default mode.
+	IntegrityModeJournal IntegrityMode = iota
+	// IntegrityModeDirect writes data and tags directly, without a journal.
+	IntegrityModeDirect
+	// IntegrityModeBitmap tracks dirty regions using a bitmap instead of a journal.
+	IntegrityModeBitmap
+	// IntegrityModeRecovery disables both the journal and integrity checks.
+	IntegrityModeRecovery
+)
+
+// IntegrityActivation holds the options used to activate a standalone Integrity device.
+// IntegrityParams must provide the integrity algorithm, and the journal algorithms and keys, if any.
+// IntegrityKey is required by keyed integrity algorithms only.
+type IntegrityActivation struct {
+	IntegrityParams
+	IntegrityKey     string
+	Mode             IntegrityMode
+	Recalculate      bool
+	ResetRecalculate bool
+	Flags            int
+}
+
+// flags returns the activation flags matching the activation options.
+func (activation IntegrityActivation) flags() int {
+	flags := activation.Flags
+
+	flags |= int(activation.modeFlag())
+
+	if activation.Recalculate {
+		flags |= CRYPT_ACTIVATE_RECALCULATE
+	}
+
+	if activation.ResetRecalculate {
+		flags |= CRYPT_ACTIVATE_RECALCULATE_RESET
+	}
+
+	return flags
+}
+
+// supported reports whether the installed libcryptsetup knows every flag the activation options require.
+func (activation IntegrityActivation) supported() bool {
+	lateFlags := CRYPT_ACTIVATE_RECALCULATE | CRYPT_ACTIVATE_NO_JOURNAL_BITMAP | CRYPT_ACTIVATE_RECALCULATE_RESET
+
+	return activation.flags()&lateFlags&^int(C.integrity_supported_flags()) == 0
+}
+
+// modeFlag returns the activation flag an active device reports for the activation's mode, or 0 for the journal mode.
+func (activation IntegrityActivation) modeFlag() uint32 {
+	switch activation.Mode {
+	case IntegrityModeDirect:
+		return CRYPT_ACTIVATE_NO_JOURNAL
+	case IntegrityModeBitmap:
+		return CRYPT_ACTIVATE_NO_JOURNAL_BITMAP
+	case IntegrityModeRecovery:
+		return CRYPT_ACTIVATE_RECOVERY
+	}
+
+	return 0
+}
+
+// Name returns the INTEGRITY device type name as a string.
+func (integrity Integrity) Name() string {
+	return C.CRYPT_INTEGRITY
+}
+
+// Unmanaged is used to specialize Integrity.
+func (integrity Integrity) Unmanaged() (unsafe.Pointer, func()) {
+	deallocations := make([]func(), 0)
+	deallocate := func() {
+		for index := 0; index < len(deallocations); index++ {
+			deallocations[index]()
+		}
+	}
+
+	cParams := integrity.IntegrityParams.unmanaged(&deallocations)
+
+	return unsafe.Pointer(cParams), deallocate
+}
+
+// unmanaged allocates a C representation of IntegrityParams.
+// Every function required to release it is appended to 'deallocations'.
+func (integrityParams *IntegrityParams) unmanaged(deallocations *[]func()) *C.struct_crypt_params_integrity {
+	cIntegrityParams := (*C.struct_crypt_params_integrity)(C.malloc(C.sizeof_struct_crypt_params_integrity))
+
+	cIntegrityParams.journal_size = C.uint64_t(integrityParams.JournalSize)
+	cIntegrityParams.journal_watermark = C.uint(integrityParams.JournalWatermark)
+	cIntegrityParams.journal_commit_time = C.uint(integrityParams.JournalCommitTime)
+
+	cIntegrityParams.interleave_sectors = C.uint32_t(integrityParams.InterleaveSectors)
+	cIntegrityParams.tag_size = C.uint32_t(integrityParams.TagSize)
+	cIntegrityParams.sector_size = C.uint32_t(integrityParams.SectorSize)
+	cIntegrityParams.buffer_sectors = C.uint32_t(integrityParams.BufferSectors)
+
+	cIntegrityParams.integrity = nil
+	if integrityParams.Integrity != "" {
+		cIntegrityParams.integrity = C.CString(integrityParams.Integrity)
+		*deallocations = append(*deallocations, func() {
+			C.free(unsafe.Pointer(cIntegrityParams.integrity))
+		})
+	}
+	cIntegrityParams.integrity_key_size = C.uint32_t(integrityParams.IntegrityKeySize)
+
+	cIntegrityParams.journal_integrity = nil
+	if integrityParams.JournalIntegrity != "" {
+		cIntegrityParams.journal_integrity = C.CString(integrityParams.JournalIntegrity)
+		*deallocations = append(*deallocations, func() {
+			C.free(unsafe.Pointer(cIntegrityParams.journal_integrity))
+		})
+	}
+	cIntegrityParams.journal_integrity_key = nil
+	if integrityParams.JournalIntegrityKey != "" {
+		cIntegrityParams.journal_integrity_key = C.CString(integrityParams.JournalIntegrityKey)
+		*deallocations = append(*deallocations, func() {
+			C.free(unsafe.Pointer(cIntegrityParams.journal_integrity_key))
+		})
+	}
+	cIntegrityParams.journal_integrity_key_size = C.uint32_t(integrityParams.JournalIntegrityKeySize)
+
+	cIntegrityParams.journal_crypt = nil
+	if integrityParams.JournalCrypt != "" {
+		cIntegrityParams.journal_crypt = C.CString(integrityParams.JournalCrypt)
+		*deallocations = append(*deallocations, func() {
+			C.free(unsafe.Pointer(cIntegrityParams.journal_crypt))
+		})
+	}
+	cIntegrityParams.journal_crypt_key = nil
+	if integrityParams.JournalCryptKey != "" {
+		cIntegrityParams.journal_crypt_key = C.CString(integrityParams.JournalCryptKey)
+		*deallocations = append(*deallocations, func() {
+			C.free(unsafe.Pointer(cIntegrityParams.journal_crypt_key))
+		})
+	}
+	cIntegrityParams.journal_crypt_key_size = C.uint32_t(integrityParams.JournalCryptKeySize)
+
+	*deallocations = append(*deallocations, func() {
+		C.free(unsafe.Pointer(cIntegrityParams))
+	})
+
+	return cIntegrityParams
+}
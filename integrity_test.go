@@ -0,0 +1,303 @@
+package cryptsetup
+
+import (
+	"testing"
+)
+
+func Test_Integrity_Format(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	integrity := Integrity{IntegrityParams{
+		Integrity:  "crc32c",
+		TagSize:    4,
+		SectorSize: 512,
+	}}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+
+	hashBeforeFormat := getFileMD5(DevicePath, test)
+
+	err = device.Format(integrity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	hashAfterFormat := getFileMD5(DevicePath, test)
+
+	if hashBeforeFormat == hashAfterFormat {
+		test.Error("Unsuccessful call to Format() when using Integrity parameters.")
+	}
+
+	if device.Type() != "INTEGRITY" {
+		test.Error("Expected type: INTEGRITY.")
+	}
+
+	device.Free()
+}
+
+func Test_Integrity_Load_ActivateByVolumeKey_Deactivate(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	integrity := Integrity{IntegrityParams{
+		Integrity:  "crc32c",
+		TagSize:    4,
+		SectorSize: 512,
+	}}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(integrity, GenericParams{})
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Load(Integrity{IntegrityParams{Integrity: "crc32c"}})
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "INTEGRITY" {
+		test.Error("Expected type: INTEGRITY.")
+	}
+
+	err = device.ActivateByVolumeKey(DeviceName, "", 0, 0)
+	testWrapper.AssertNoError(err)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+
+	device.Free()
+}
+
+func Test_Integrity_Format_ActivateByVolumeKey_Deactivate_Using_Keyed_Algorithm(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	integrity := Integrity{IntegrityParams{
+		Integrity:        "hmac(sha256)",
+		IntegrityKeySize: 32,
+		TagSize:          32,
+		SectorSize:       4096,
+	}}
+	genericParams := GenericParams{
+		VolumeKey:     generateKey(32, test),
+		VolumeKeySize: 32,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(integrity, genericParams)
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByVolumeKey(DeviceName, genericParams.VolumeKey, genericParams.VolumeKeySize, 0)
+	testWrapper.AssertNoError(err)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+
+	device.Free()
+}
+
+func Test_Integrity_Load_Fails_If_Device_Is_Not_Formatted(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+
+	err = device.Load(Integrity{})
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	device.Free()
+}
+
+func Test_Integrity_Load_GetIntegrityInfo(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	integrity := Integrity{IntegrityParams{
+		Integrity:         "crc32c",
+		TagSize:           4,
+		SectorSize:        4096,
+		InterleaveSectors: 32768,
+		JournalSize:       4 * 1024 * 1024,
+		JournalWatermark:  40,
+		JournalCommitTime: 5000,
+	}}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(integrity, GenericParams{})
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Load(Integrity{IntegrityParams{Integrity: "crc32c"}})
+	testWrapper.AssertNoError(err)
+
+	integrityParams, err := device.GetIntegrityInfo()
+	testWrapper.AssertNoError(err)
+
+	if integrityParams.Integrity != "crc32c" {
+		test.Errorf("Expected integrity algorithm 'crc32c', got '%s'.", integrityParams.Integrity)
+	}
+	if integrityParams.TagSize != 4 {
+		test.Errorf("Expected tag size 4, got %d.", integrityParams.TagSize)
+	}
+	if integrityParams.SectorSize != 4096 {
+		test.Errorf("Expected sector size 4096, got %d.", integrityParams.SectorSize)
+	}
+	if integrityParams.InterleaveSectors != 32768 {
+		test.Errorf("Expected 32768 interleave sectors, got %d.", integrityParams.InterleaveSectors)
+	}
+	if integrityParams.JournalSize != 4*1024*1024 {
+		test.Errorf("Expected journal size %d, got %d.", 4*1024*1024, integrityParams.JournalSize)
+	}
+}
+
+func Test_Integrity_GetIntegrityInfo_Fails_If_Device_Has_No_Type(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	_, err = device.GetIntegrityInfo()
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -95)
+}
+
+func Test_Integrity_ActivateIntegrity_Modes(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	integrityParams := IntegrityParams{
+		Integrity:  "crc32c",
+		TagSize:    4,
+		SectorSize: 512,
+	}
+
+	activations := map[string]IntegrityActivation{
+		"journal":  {IntegrityParams: integrityParams, Mode: IntegrityModeJournal},
+		"direct":   {IntegrityParams: integrityParams, Mode: IntegrityModeDirect},
+		"bitmap":   {IntegrityParams: integrityParams, Mode: IntegrityModeBitmap},
+		"recovery": {IntegrityParams: integrityParams, Mode: IntegrityModeRecovery},
+	}
+	expectedFlags := map[string]uint32{
+		"journal":  0,
+		"direct":   CRYPT_ACTIVATE_NO_JOURNAL,
+		"bitmap":   CRYPT_ACTIVATE_NO_JOURNAL_BITMAP,
+		"recovery": CRYPT_ACTIVATE_RECOVERY,
+	}
+	modeFlags := uint32(CRYPT_ACTIVATE_NO_JOURNAL | CRYPT_ACTIVATE_NO_JOURNAL_BITMAP | CRYPT_ACTIVATE_RECOVERY)
+
+	for mode, activation := range activations {
+		if !activation.supported() {
+			test.Logf("Mode '%s' is not supported by the installed libcryptsetup.", mode)
+			continue
+		}
+
+		device, err := Init(DevicePath)
+		testWrapper.AssertNoError(err)
+		err = device.Format(Integrity{integrityParams}, GenericParams{})
+		testWrapper.AssertNoError(err)
+
+		err = device.ActivateIntegrity(DeviceName, activation)
+		testWrapper.AssertNoError(err)
+
+		activeDevice, err := device.GetActiveDevice(DeviceName)
+		testWrapper.AssertNoError(err)
+
+		if activeDevice.Flags&modeFlags != expectedFlags[mode] {
+			test.Errorf("Mode '%s': expected mode flags %#x, got %#x.", mode, expectedFlags[mode], activeDevice.Flags&modeFlags)
+		}
+
+		err = device.Deactivate(DeviceName)
+		testWrapper.AssertNoError(err)
+
+		device.Free()
+	}
+}
+
+func Test_Integrity_ActivateIntegrity_Recalculate(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	integrityParams := IntegrityParams{
+		Integrity:  "crc32c",
+		TagSize:    4,
+		SectorSize: 512,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(Integrity{integrityParams}, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	for _, activation := range []IntegrityActivation{
+		{IntegrityParams: integrityParams, Recalculate: true},
+		{IntegrityParams: integrityParams, Recalculate: true, ResetRecalculate: true},
+	} {
+		if !activation.supported() {
+			test.Logf("Activation %+v is not supported by the installed libcryptsetup.", activation)
+			continue
+		}
+
+		err = device.ActivateIntegrity(DeviceName, activation)
+		testWrapper.AssertNoError(err)
+
+		activeDevice, err := device.GetActiveDevice(DeviceName)
+		testWrapper.AssertNoError(err)
+
+		// The kernel only reports recalculation while it's in progress, but keeps reporting a reset.
+		if activation.ResetRecalculate && activeDevice.Flags&CRYPT_ACTIVATE_RECALCULATE_RESET == 0 {
+			test.Errorf("Expected flag %#x to be set, got %#x.", CRYPT_ACTIVATE_RECALCULATE_RESET, activeDevice.Flags)
+		}
+
+		// Tags of a freshly formatted device are invalid until recalculated,
+		// and reading the whole device fails if any tag is invalid and not being recalculated.
+		getFileMD5("/dev/mapper/"+DeviceName, test)
+
+		err = device.Deactivate(DeviceName)
+		testWrapper.AssertNoError(err)
+	}
+}
+
+func Test_Integrity_ActivateIntegrity_Using_Journal_Keys(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	journalIntegrityKey := generateKey(32, test)
+	journalCryptKey := generateKey(32, test)
+	integrityParams := IntegrityParams{
+		Integrity:               "crc32c",
+		TagSize:                 4,
+		SectorSize:              512,
+		JournalIntegrity:        "hmac(sha256)",
+		JournalIntegrityKey:     journalIntegrityKey,
+		JournalIntegrityKeySize: 32,
+		JournalCrypt:            "cbc(aes)",
+		JournalCryptKey:         journalCryptKey,
+		JournalCryptKeySize:     32,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(Integrity{integrityParams}, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateIntegrity(DeviceName, IntegrityActivation{IntegrityParams: integrityParams})
+	testWrapper.AssertNoError(err)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_Integrity_ActivateIntegrity_Fails_If_Device_Is_Not_Formatted(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.ActivateIntegrity(DeviceName, IntegrityActivation{IntegrityParams: IntegrityParams{Integrity: "crc32c"}, Mode: IntegrityModeBitmap})
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
@@ -8,13 +8,36 @@ package cryptsetup
 extern void log_callback(int level, char * message, void * usrptr);
 */
 import "C"
-import "unsafe"
+import (
+	"sync"
+	"unsafe"
+)
 
 var logCallback func(level int, message string)
 
+// debugLevel is the level set by SetDebugLevel. Debug messages are only forwarded to the callback when it's enabled,
+// since debugging may be enabled internally to capture them.
+var debugLevel = CRYPT_DEBUG_NONE
+
+type logEntry struct {
+	level   int
+	message string
+}
+
+var logCaptures = make(map[unsafe.Pointer]*[]logEntry)
+var logCapturesMutex sync.Mutex
+
 //export log_callback
 func log_callback(level C.int, message *C.char, usrptr unsafe.Pointer) {
-	if logCallback != nil {
+	if usrptr != nil {
+		logCapturesMutex.Lock()
+		if entries, found := logCaptures[usrptr]; found {
+			*entries = append(*entries, logEntry{level: int(level), message: C.GoString(message)})
+		}
+		logCapturesMutex.Unlock()
+	}
+
+	if logCallback != nil && (int(level) != CRYPT_LOG_DEBUG || debugLevel != CRYPT_DEBUG_NONE) {
 		logCallback(int(level), C.GoString(message))
 	}
 }
@@ -24,3 +47,24 @@ func SetLogCallback(newLogCallback func(level int, message string)) {
 
 	C.crypt_set_log_callback(nil, (*[0]byte)(C.log_callback), nil)
 }
+
+// captureLog calls 'call', collecting every message libcryptsetup logs for the device in the meantime.
+// Messages are still forwarded to the callback set by SetLogCallback.
+func (device *Device) captureLog(call func()) []logEntry {
+	usrptr := unsafe.Pointer(device.cryptDevice)
+	entries := make([]logEntry, 0)
+
+	logCapturesMutex.Lock()
+	logCaptures[usrptr] = &entries
+	logCapturesMutex.Unlock()
+
+	C.crypt_set_log_callback(device.cryptDevice, (*[0]byte)(C.log_callback), usrptr)
+	call()
+	C.crypt_set_log_callback(device.cryptDevice, nil, nil)
+
+	logCapturesMutex.Lock()
+	delete(logCaptures, usrptr)
+	logCapturesMutex.Unlock()
+
+	return entries
+}
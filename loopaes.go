@@ -0,0 +1,46 @@
+package cryptsetup
+
+// #cgo pkg-config: libcryptsetup
+// #include <libcryptsetup.h>
+// #include <stdlib.h>
+import "C"
+import "unsafe"
+
+// LoopAES is the struct used to manipulate loop-AES compatible devices.
+// loop-AES devices have no on-disk header: they're formatted using their cipher and key size,
+// and then activated using ActivateByKeyFile() with a loop-AES keyfile.
+type LoopAES struct {
+	Hash   string
+	Offset uint64
+	Skip   uint64
+}
+
+// Name returns the LOOPAES device type name as a string.
+func (loopAES LoopAES) Name() string {
+	return C.CRYPT_LOOPAES
+}
+
+// Unmanaged is used to specialize LoopAES.
+func (loopAES LoopAES) Unmanaged() (unsafe.Pointer, func()) {
+	deallocations := make([]func(), 0, 1)
+	deallocate := func() {
+		for index := 0; index < len(deallocations); index++ {
+			deallocations[index]()
+		}
+	}
+
+	var cParams C.struct_crypt_params_loopaes
+
+	cParams.hash = nil
+	if loopAES.Hash != "" {
+		cParams.hash = C.CString(loopAES.Hash)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.hash))
+		})
+	}
+
+	cParams.offset = C.uint64_t(loopAES.Offset)
+	cParams.skip = C.uint64_t(loopAES.Skip)
+
+	return unsafe.Pointer(&cParams), deallocate
+}
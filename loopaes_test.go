@@ -0,0 +1,76 @@
+package cryptsetup
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+const LoopAESKeyFilePath string = "testLoopAESKeyFile"
+
+func createLoopAESKeyFile(keyCount int, test *testing.T) {
+	keys := make([]string, 0, keyCount)
+	for index := 0; index < keyCount; index++ {
+		keys = append(keys, base64.StdEncoding.EncodeToString([]byte(generateKey(32, test))))
+	}
+
+	err := os.WriteFile(LoopAESKeyFilePath, []byte(strings.Join(keys, "\n")+"\n"), 0600)
+	if err != nil {
+		test.Fatal(err)
+	}
+}
+
+func Test_LoopAES_Format(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+
+	err = device.Format(LoopAES{Hash: "sha256"}, GenericParams{Cipher: "aes", VolumeKeySize: 256 / 8})
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "LOOPAES" {
+		test.Error("Expected type: LOOPAES.")
+	}
+
+	device.Free()
+}
+
+func Test_LoopAES_ActivateByKeyFile_Deactivate(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	createLoopAESKeyFile(65, test)
+	defer os.Remove(LoopAESKeyFilePath)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LoopAES{Hash: "sha256"}, GenericParams{Cipher: "aes", VolumeKeySize: 256 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByKeyFile(DeviceName, CRYPT_ANY_SLOT, LoopAESKeyFilePath, 0, CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertNoError(err)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_LoopAES_ActivateByKeyFile_Fails_If_KeyFile_Is_Invalid(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	createLoopAESKeyFile(2, test)
+	defer os.Remove(LoopAESKeyFilePath)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LoopAES{Hash: "sha256"}, GenericParams{Cipher: "aes", VolumeKeySize: 256 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByKeyFile("", CRYPT_ANY_SLOT, LoopAESKeyFilePath, 0, CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
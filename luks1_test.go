@@ -1,6 +1,7 @@
 package cryptsetup
 
 import (
+	"os"
 	"testing"
 )
 
@@ -253,3 +254,66 @@ func Test_LUKS1_Resize(test *testing.T) {
 	err = device.Resize(DeviceName, 0)
 	testWrapper.AssertNoError(err)
 }
+
+func Test_LUKS1_Repair(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	// damage the stripes of keyslot 1, which is disabled
+	file, err := os.OpenFile(DevicePath, os.O_RDWR, 0)
+	testWrapper.AssertNoError(err)
+	_, err = file.WriteAt([]byte{0, 0, 0, 1}, 208+48+44)
+	testWrapper.AssertNoError(err)
+	file.Close()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(nil)
+	testWrapper.AssertError(err)
+
+	messages, err := device.Repair(LUKS1{})
+	testWrapper.AssertNoError(err)
+
+	if !containsString(messages, "Keyslot 1: stripes repaired (1 -> 4000).") {
+		test.Errorf("Repair should have reported the repaired keyslot, reported: %q.", messages)
+	}
+
+	if device.Type() != "LUKS1" {
+		test.Error("Expected type: LUKS1.")
+	}
+
+	err = device.ActivateByPassphrase("", 0, "testPassphrase", 0)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_LUKS1_Repair_Fails_If_Device_Has_No_Header(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	file, err := os.OpenFile(DevicePath, os.O_RDWR, 0)
+	testWrapper.AssertNoError(err)
+	_, err = file.WriteAt(make([]byte, 4096), 0)
+	testWrapper.AssertNoError(err)
+	file.Close()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	_, err = device.Repair(LUKS1{})
+	testWrapper.AssertError(err)
+}
@@ -8,6 +8,8 @@ import "C"
 import "unsafe"
 
 // LUKS2 is the struct used to manipulate LUKS2 devices.
+// MetadataSize and KeyslotsSize are expressed in bytes, and are set using SetMetadataSize() when formatting,
+// so they require libcryptsetup 2.1 or newer.
 type LUKS2 struct {
 	PBKDFType       *PbkdfType
 	Integrity       string
@@ -17,6 +19,8 @@ type LUKS2 struct {
 	SectorSize      uint32
 	Label           string
 	Subsystem       string
+	MetadataSize    uint64
+	KeyslotsSize    uint64
 }
 
 type PbkdfType struct {
@@ -29,28 +33,6 @@ type PbkdfType struct {
 	Flags           uint32
 }
 
-type IntegrityParams struct {
-	JournalSize       uint64
-	JournalWatermark  uint
-	JournalCommitTime uint
-
-	InterleaveSectors uint32
-	TagSize           uint32
-	SectorSize        uint32
-	BufferSectors     uint32
-
-	Integrity        string
-	IntegrityKeySize uint32
-
-	JournalIntegrity        string
-	JournalIntegrityKey     string
-	JournalIntegrityKeySize uint32
-
-	JournalCrypt        string
-	JournalCryptKey     string
-	JournalCryptKeySize uint32
-}
-
 // Name returns the LUKS2 device type name as a string.
 func (luks2 LUKS2) Name() string {
 	return C.CRYPT_LUKS2
@@ -105,97 +87,65 @@ func (luks2 LUKS2) Unmanaged() (unsafe.Pointer, func()) {
 
 	cParams.pbkdf = nil
 	if luks2.PBKDFType != nil {
-		cPBKDFType := (*C.struct_crypt_pbkdf_type)(C.malloc(C.sizeof_struct_crypt_pbkdf_type))
-
-		cPBKDFType._type = nil
-		if luks2.PBKDFType.Type != "" {
-			cPBKDFType._type = C.CString(luks2.PBKDFType.Type)
-			deallocations = append(deallocations, func() {
-				C.free(unsafe.Pointer(cPBKDFType._type))
-			})
-		}
+		cParams.pbkdf = luks2.PBKDFType.unmanaged(&deallocations)
+	}
 
-		cPBKDFType.hash = nil
-		if luks2.PBKDFType.Hash != "" {
-			cPBKDFType.hash = C.CString(luks2.PBKDFType.Hash)
-			deallocations = append(deallocations, func() {
-				C.free(unsafe.Pointer(cPBKDFType.hash))
-			})
-		}
+	cParams.integrity_params = nil
+	if luks2.IntegrityParams != nil {
+		cParams.integrity_params = luks2.IntegrityParams.unmanaged(&deallocations)
+	}
 
-		cPBKDFType.time_ms = C.uint32_t(luks2.PBKDFType.TimeMs)
-		cPBKDFType.iterations = C.uint32_t(luks2.PBKDFType.Iterations)
-		cPBKDFType.max_memory_kb = C.uint32_t(luks2.PBKDFType.MaxMemoryKb)
-		cPBKDFType.parallel_threads = C.uint32_t(luks2.PBKDFType.ParallelThreads)
-		cPBKDFType.flags = C.uint32_t(luks2.PBKDFType.Flags)
+	return unsafe.Pointer(&cParams), deallocate
+}
 
-		deallocations = append(deallocations, func() {
-			C.free(unsafe.Pointer(cPBKDFType))
+// unmanaged allocates a C representation of PbkdfType.
+// Every function required to release it is appended to 'deallocations'.
+func (pbkdfType *PbkdfType) unmanaged(deallocations *[]func()) *C.struct_crypt_pbkdf_type {
+	cPBKDFType := (*C.struct_crypt_pbkdf_type)(C.malloc(C.sizeof_struct_crypt_pbkdf_type))
+
+	cPBKDFType._type = nil
+	if pbkdfType.Type != "" {
+		cPBKDFType._type = C.CString(pbkdfType.Type)
+		*deallocations = append(*deallocations, func() {
+			C.free(unsafe.Pointer(cPBKDFType._type))
 		})
+	}
 
-		cParams.pbkdf = cPBKDFType
+	cPBKDFType.hash = nil
+	if pbkdfType.Hash != "" {
+		cPBKDFType.hash = C.CString(pbkdfType.Hash)
+		*deallocations = append(*deallocations, func() {
+			C.free(unsafe.Pointer(cPBKDFType.hash))
+		})
 	}
 
-	cParams.integrity_params = nil
-	if luks2.IntegrityParams != nil {
-		cIntegrityParams := (*C.struct_crypt_params_integrity)(C.malloc(C.sizeof_struct_crypt_params_integrity))
-
-		cIntegrityParams.journal_size = C.uint64_t(luks2.IntegrityParams.JournalSize)
-		cIntegrityParams.journal_watermark = C.uint(luks2.IntegrityParams.JournalWatermark)
-		cIntegrityParams.journal_commit_time = C.uint(luks2.IntegrityParams.JournalCommitTime)
-
-		cIntegrityParams.interleave_sectors = C.uint32_t(luks2.IntegrityParams.InterleaveSectors)
-		cIntegrityParams.tag_size = C.uint32_t(luks2.IntegrityParams.TagSize)
-		cIntegrityParams.sector_size = C.uint32_t(luks2.IntegrityParams.SectorSize)
-		cIntegrityParams.buffer_sectors = C.uint32_t(luks2.IntegrityParams.BufferSectors)
-
-		cIntegrityParams.integrity = nil
-		if luks2.IntegrityParams.Integrity != "" {
-			cIntegrityParams.integrity = C.CString(luks2.IntegrityParams.Integrity)
-			deallocations = append(deallocations, func() {
-				C.free(unsafe.Pointer(cIntegrityParams.integrity))
-			})
-		}
-		cIntegrityParams.integrity_key_size = C.uint32_t(luks2.IntegrityParams.IntegrityKeySize)
-
-		cIntegrityParams.journal_integrity = nil
-		if luks2.IntegrityParams.JournalIntegrity != "" {
-			cIntegrityParams.journal_integrity = C.CString(luks2.IntegrityParams.JournalIntegrity)
-			deallocations = append(deallocations, func() {
-				C.free(unsafe.Pointer(cIntegrityParams.journal_integrity))
-			})
-		}
-		cIntegrityParams.journal_integrity_key = nil
-		if luks2.IntegrityParams.JournalIntegrityKey != "" {
-			cIntegrityParams.journal_integrity_key = C.CString(luks2.IntegrityParams.JournalIntegrityKey)
-			deallocations = append(deallocations, func() {
-				C.free(unsafe.Pointer(cIntegrityParams.journal_integrity_key))
-			})
-		}
-		cIntegrityParams.journal_integrity_key_size = C.uint32_t(luks2.IntegrityParams.JournalIntegrityKeySize)
-
-		cIntegrityParams.journal_crypt = nil
-		if luks2.IntegrityParams.JournalCrypt != "" {
-			cIntegrityParams.journal_crypt = C.CString(luks2.IntegrityParams.JournalCrypt)
-			deallocations = append(deallocations, func() {
-				C.free(unsafe.Pointer(cIntegrityParams.journal_crypt))
-			})
-		}
-		cIntegrityParams.journal_crypt_key = nil
-		if luks2.IntegrityParams.JournalCryptKey != "" {
-			cIntegrityParams.journal_crypt_key = C.CString(luks2.IntegrityParams.JournalCryptKey)
-			deallocations = append(deallocations, func() {
-				C.free(unsafe.Pointer(cIntegrityParams.journal_crypt_key))
-			})
-		}
-		cIntegrityParams.journal_crypt_key_size = C.uint32_t(luks2.IntegrityParams.JournalCryptKeySize)
+	cPBKDFType.time_ms = C.uint32_t(pbkdfType.TimeMs)
+	cPBKDFType.iterations = C.uint32_t(pbkdfType.Iterations)
+	cPBKDFType.max_memory_kb = C.uint32_t(pbkdfType.MaxMemoryKb)
+	cPBKDFType.parallel_threads = C.uint32_t(pbkdfType.ParallelThreads)
+	cPBKDFType.flags = C.uint32_t(pbkdfType.Flags)
 
-		deallocations = append(deallocations, func() {
-			C.free(unsafe.Pointer(cIntegrityParams))
-		})
+	*deallocations = append(*deallocations, func() {
+		C.free(unsafe.Pointer(cPBKDFType))
+	})
 
-		cParams.integrity_params = cIntegrityParams
+	return cPBKDFType
+}
+
+// newPbkdfType copies a C representation of PbkdfType.
+// Returns nil if 'cPBKDFType' is nil.
+func newPbkdfType(cPBKDFType *C.struct_crypt_pbkdf_type) *PbkdfType {
+	if cPBKDFType == nil {
+		return nil
 	}
 
-	return unsafe.Pointer(&cParams), deallocate
+	return &PbkdfType{
+		Type:            C.GoString(cPBKDFType._type),
+		Hash:            C.GoString(cPBKDFType.hash),
+		TimeMs:          uint32(cPBKDFType.time_ms),
+		Iterations:      uint32(cPBKDFType.iterations),
+		MaxMemoryKb:     uint32(cPBKDFType.max_memory_kb),
+		ParallelThreads: uint32(cPBKDFType.parallel_threads),
+		Flags:           uint32(cPBKDFType.flags),
+	}
 }
@@ -1,6 +1,9 @@
 package cryptsetup
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -367,6 +370,103 @@ func Test_LUKS2_Wipe(test *testing.T) {
 	device.Free()
 }
 
+func Test_LUKS2_FormatAuthenticated(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	luks2Params := LUKS2{
+		SectorSize: 4096,
+		Integrity:  "hmac(sha256)",
+	}
+	genericParams := GenericParams{
+		Cipher:        "aes",
+		CipherMode:    "xts-random",
+		VolumeKeySize: 512/8 + 256/8,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+
+	progressCalls := 0
+	err = device.FormatAuthenticated(luks2Params, genericParams, func(size, offset uint64) int {
+		progressCalls++
+		return 0
+	})
+	testWrapper.AssertNoError(err)
+
+	if progressCalls == 0 {
+		test.Error("Progress callback should have been called.")
+	}
+
+	if device.Type() != "LUKS2" {
+		test.Error("Expected type: LUKS2.")
+	}
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByPassphrase(DeviceName, 0, "testPassphrase", CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertNoError(err)
+
+	// Reading the whole device fails if any integrity tag is invalid.
+	getFileMD5("/dev/mapper/"+DeviceName, test)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+
+	device.Free()
+}
+
+func Test_LUKS2_FormatAuthenticated_Fails_For_Invalid_Parameters(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	luks2Params := LUKS2{
+		SectorSize: 512,
+		Integrity:  "poly1305",
+	}
+	genericParams := GenericParams{
+		Cipher:        "aes",
+		CipherMode:    "xts-plain64",
+		VolumeKeySize: 512 / 8,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+
+	err = device.FormatAuthenticated(luks2Params, genericParams, nil)
+	testWrapper.AssertError(err)
+
+	device.Free()
+}
+
+func Test_LUKS2_FormatAuthenticated_Fails_Without_Integrity(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	genericParams := GenericParams{
+		Cipher:        "aes",
+		CipherMode:    "xts-plain64",
+		VolumeKeySize: 512 / 8,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.FormatAuthenticated(LUKS2{SectorSize: 512}, genericParams, nil)
+	if err != ErrNoIntegrity {
+		test.Errorf("Expected ErrNoIntegrity, got: %v", err)
+	}
+
+	if device.Type() != "" {
+		test.Errorf("Device should not have been formatted, got type: %s", device.Type())
+	}
+}
+
 func Test_LUKS2_Resize(test *testing.T) {
 	resizeDiskPath := "testResizeDevice"
 	setup(resizeDiskPath)
@@ -397,3 +497,621 @@ func Test_LUKS2_Resize(test *testing.T) {
 	err = device.Resize(DeviceName, 0)
 	testWrapper.AssertNoError(err)
 }
+
+func Test_LUKS2_InitDataDevice_Format_HeaderIsDetached(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := InitDataDevice(HeaderDevicePath, DevicePath)
+	testWrapper.AssertNoError(err)
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	detached, err := device.HeaderIsDetached()
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+	if !detached {
+		test.Error("Header should be detached.")
+	}
+
+	if device.GetDeviceName() != DevicePath {
+		test.Errorf("Data device should be '%s', but '%s' was returned instead.", DevicePath, device.GetDeviceName())
+	}
+
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(nil)
+	testWrapper.AssertError(err)
+}
+
+func Test_LUKS2_Load_DataDevice_HeaderIsDetached(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := InitDataDevice(HeaderDevicePath, DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(HeaderDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(LUKS2{DataDevice: DevicePath})
+	testWrapper.AssertNoError(err)
+
+	detached, err := device.HeaderIsDetached()
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+	if !detached {
+		test.Error("Header should be detached.")
+	}
+
+	if device.GetDeviceName() != DevicePath {
+		test.Errorf("Data device should be '%s', but '%s' was returned instead.", DevicePath, device.GetDeviceName())
+	}
+}
+
+func Test_LUKS2_Load_Without_DataDevice_Is_Not_Detached(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	detached, err := device.HeaderIsDetached()
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+	if detached {
+		test.Error("Header should not be detached.")
+	}
+}
+
+func Test_LUKS2_DetachedHeader_ActivateByPassphrase_Resize_InitByNameAndHeader_Deactivate(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := InitDataDevice(HeaderDevicePath, DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(HeaderDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(LUKS2{DataDevice: DevicePath})
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByPassphrase(DeviceName, 0, "testPassphrase", CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertNoError(err)
+
+	err = device.Resize(DeviceName, 0)
+	testWrapper.AssertNoError(err)
+
+	activeDevice, err := InitByNameAndHeader(DeviceName, HeaderDevicePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	detached, err := activeDevice.HeaderIsDetached()
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+	if !detached {
+		test.Error("Header should be detached.")
+	}
+	activeDevice.Free()
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_LUKS2_Convert_To_LUKS1_And_Back(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	pbkdfType := PbkdfType{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512, PBKDFType: &pbkdfType}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	err = device.Convert(LUKS1{}, nil)
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "LUKS1" {
+		test.Error("Expected type: LUKS1.")
+	}
+
+	err = device.Convert(LUKS2{}, nil)
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "LUKS2" {
+		test.Error("Expected type: LUKS2.")
+	}
+
+	_, _, err = device.VolumeKeyGet(0, "testPassphrase")
+	testWrapper.AssertNoError(err)
+}
+
+func Test_LUKS2_Convert_To_LUKS1_Fails_If_Keyslot_Uses_Argon2(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	pbkdfType := PbkdfType{Type: "argon2id", Hash: "sha256", Iterations: 4, MaxMemoryKb: 32 * 1024, ParallelThreads: 1, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512, PBKDFType: &pbkdfType}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	hashBeforeConvert := getFileMD5(DevicePath, test)
+
+	err = device.Convert(LUKS1{}, nil)
+	skipIfNotSupported(err, test)
+	if err != ErrConvertUnsupportedPBKDF {
+		test.Errorf("Expected ErrConvertUnsupportedPBKDF, got: %v.", err)
+	}
+
+	if device.Type() != "LUKS2" || getFileMD5(DevicePath, test) != hashBeforeConvert {
+		test.Error("Device should not have been modified.")
+	}
+}
+
+func Test_LUKS2_Convert_To_LUKS1_Leaves_Header_Intact_If_Conversion_Fails(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	pbkdfType := PbkdfType{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 4096, PBKDFType: &pbkdfType}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	hashBeforeConvert := getFileMD5(DevicePath, test)
+
+	var backup bytes.Buffer
+	err = device.Convert(LUKS1{}, &backup)
+	skipIfNotSupported(err, test)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	if backup.Len() == 0 {
+		test.Error("Header backup should have been written.")
+	}
+
+	if getFileMD5(DevicePath, test) != hashBeforeConvert {
+		test.Error("Device should not have been modified.")
+	}
+
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "LUKS2" {
+		test.Error("Expected type: LUKS2.")
+	}
+
+	_, _, err = device.VolumeKeyGet(0, "testPassphrase")
+	testWrapper.AssertNoError(err)
+}
+
+func Test_LUKS2_Convert_Writes_Header_Backup(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	pbkdfType := PbkdfType{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512, PBKDFType: &pbkdfType}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	backupFile := filepath.Join(test.TempDir(), "header")
+	backup, err := os.Create(backupFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	err = device.Convert(LUKS1{}, backup)
+	backup.Close()
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "LUKS1" {
+		test.Error("Expected type: LUKS1.")
+	}
+
+	restoredDevice, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer restoredDevice.Free()
+
+	err = restoredDevice.HeaderRestore(backupFile)
+	testWrapper.AssertNoError(err)
+
+	err = restoredDevice.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	if restoredDevice.Type() != "LUKS2" {
+		test.Error("Expected type: LUKS2.")
+	}
+
+	_, _, err = restoredDevice.VolumeKeyGet(0, "testPassphrase")
+	testWrapper.AssertNoError(err)
+}
+
+func Test_LUKS2_Convert_Fails_If_Type_Is_Unsupported(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	hashBeforeConvert := getFileMD5(DevicePath, test)
+
+	err = device.Convert(Plain{}, nil)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	if device.Type() != "LUKS2" || getFileMD5(DevicePath, test) != hashBeforeConvert {
+		test.Error("Device should not have been modified.")
+	}
+}
+
+func Test_LUKS2_Repair(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	pbkdfType := PbkdfType{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512, PBKDFType: &pbkdfType}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	// wipe the secondary header, which follows the 16 KiB primary header
+	file, err := os.OpenFile(DevicePath, os.O_RDWR, 0)
+	testWrapper.AssertNoError(err)
+	_, err = file.WriteAt(make([]byte, 4096), 16*1024)
+	testWrapper.AssertNoError(err)
+	file.Close()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	messages, err := device.Repair(LUKS2{})
+	testWrapper.AssertNoError(err)
+
+	if !containsString(messages, "Secondary LUKS2 header requires recovery.") {
+		test.Errorf("Repair should have reported the recovered secondary header, reported: %q.", messages)
+	}
+
+	magic := make([]byte, 6)
+	file, err = os.Open(DevicePath)
+	testWrapper.AssertNoError(err)
+	_, err = file.ReadAt(magic, 16*1024)
+	testWrapper.AssertNoError(err)
+	file.Close()
+
+	if !bytes.Equal(magic, []byte{'S', 'K', 'U', 'L', 0xba, 0xbe}) {
+		test.Errorf("Secondary header should have been restored, magic: %x.", magic)
+	}
+
+	if device.Type() != "LUKS2" {
+		test.Error("Expected type: LUKS2.")
+	}
+
+	_, _, err = device.VolumeKeyGet(0, "testPassphrase")
+	testWrapper.AssertNoError(err)
+}
+
+func Test_LUKS2_Format_Using_MetadataSize_KeyslotsSize(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	luks2 := LUKS2{SectorSize: 512, MetadataSize: 64 * 1024, KeyslotsSize: 4 * 1024 * 1024}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(luks2, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	metadataSize, keyslotsSize, err := device.MetadataSize()
+	testWrapper.AssertNoError(err)
+
+	if metadataSize != luks2.MetadataSize || keyslotsSize != luks2.KeyslotsSize {
+		test.Errorf("Unexpected metadata and keyslots sizes: %d, %d.", metadataSize, keyslotsSize)
+	}
+}
+
+func Test_LUKS2_Format_Fails_If_MetadataSize_Is_Invalid(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512, MetadataSize: 48 * 1024}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	skipIfNotSupported(err, test)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	err = device.Format(LUKS2{SectorSize: 512, KeyslotsSize: 4096 + 1}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	err = device.Format(LUKS2{SectorSize: 512, KeyslotsSize: 256 * 1024 * 1024}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	if device.Type() != "" {
+		test.Error("Device should not have been formatted.")
+	}
+}
+
+func Test_LUKS2_SetDataOffset_Format_GetDataOffset(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+
+	err = device.SetDataOffset(24 * 1024 * 1024 / 512)
+	skipIfNotSupported(err, test)
+	testWrapper.AssertNoError(err)
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	if device.GetDataOffset() != 24*1024*1024/512 {
+		test.Errorf("Data offset should be %d sectors, but %d was returned instead.", 24*1024*1024/512, device.GetDataOffset())
+	}
+}
+
+func Test_LUKS2_SetDataOffset_Fails_If_Offset_Is_Not_Aligned(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.SetDataOffset(1)
+	skipIfNotSupported(err, test)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_LUKS2_SetDataDevice_GetMetadataDeviceName(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := InitDataDevice(HeaderDevicePath, DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	if device.GetMetadataDeviceName() != HeaderDevicePath {
+		test.Errorf("Metadata device should be '%s', but '%s' was returned instead.", HeaderDevicePath, device.GetMetadataDeviceName())
+	}
+
+	err = device.SetDataDevice(HashDevicePath)
+	testWrapper.AssertNoError(err)
+
+	if device.GetDeviceName() != HashDevicePath {
+		test.Errorf("Data device should be '%s', but '%s' was returned instead.", HashDevicePath, device.GetDeviceName())
+	}
+
+	if device.GetMetadataDeviceName() != HeaderDevicePath {
+		test.Errorf("Metadata device should be '%s', but '%s' was returned instead.", HeaderDevicePath, device.GetMetadataDeviceName())
+	}
+}
+
+func Test_LUKS2_GetMetadataDeviceName_Is_Empty_If_Header_Is_Not_Detached(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	if device.GetMetadataDeviceName() != "" {
+		test.Errorf("Metadata device should be empty, but '%s' was returned instead.", device.GetMetadataDeviceName())
+	}
+}
+
+func Test_LUKS2_PersistentFlagsSet_PersistentFlagsGet(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	flags, err := device.PersistentFlagsGet(CRYPT_FLAGS_ACTIVATION)
+	testWrapper.AssertNoError(err)
+	if flags != 0 {
+		test.Errorf("No activation flags should be stored, got %d.", flags)
+	}
+
+	err = device.PersistentFlagsSet(CRYPT_FLAGS_ACTIVATION, CRYPT_ACTIVATE_ALLOW_DISCARDS|CRYPT_ACTIVATE_NO_READ_WORKQUEUE|CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE)
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Load(nil)
+	testWrapper.AssertNoError(err)
+
+	flags, err = device.PersistentFlagsGet(CRYPT_FLAGS_ACTIVATION)
+	testWrapper.AssertNoError(err)
+	if flags != CRYPT_ACTIVATE_ALLOW_DISCARDS|CRYPT_ACTIVATE_NO_READ_WORKQUEUE|CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE {
+		test.Errorf("Unexpected activation flags: %d.", flags)
+	}
+}
+
+func Test_LUKS2_GetRequirements(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	requirements, err := device.GetRequirements()
+	testWrapper.AssertNoError(err)
+	if requirements != (Requirements{}) {
+		test.Errorf("No requirements should be stored, got %+v.", requirements)
+	}
+
+	err = device.PersistentFlagsSet(CRYPT_FLAGS_REQUIREMENTS, CRYPT_REQUIREMENT_OFFLINE_REENCRYPT)
+	testWrapper.AssertNoError(err)
+
+	requirements, err = device.GetRequirements()
+	testWrapper.AssertNoError(err)
+	if !requirements.OfflineReencrypt || requirements.Unknown {
+		test.Errorf("Unexpected requirements: %+v.", requirements)
+	}
+}
+
+func Test_LUKS2_PersistentFlagsSet_Fails_If_Device_Is_Not_LUKS2(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.PersistentFlagsSet(CRYPT_FLAGS_ACTIVATION, CRYPT_ACTIVATE_ALLOW_DISCARDS)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	_, err = device.GetRequirements()
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_LUKS2_SetPBKDF_PBKDF(test *testing.T) {
+	if !pbkdfTypeSupported() {
+		test.Skip("PBKDF and DefaultPBKDF require a libcryptsetup providing crypt_get_pbkdf_type and crypt_get_pbkdf_default.")
+	}
+
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.SetPBKDF(&PbkdfType{Type: CRYPT_KDF_PBKDF2, Hash: "sha512", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK})
+	testWrapper.AssertNoError(err)
+
+	pbkdfType := device.PBKDF()
+	if pbkdfType == nil || pbkdfType.Type != CRYPT_KDF_PBKDF2 || pbkdfType.Hash != "sha512" || pbkdfType.Iterations != 1000 {
+		test.Errorf("Unexpected PBKDF: %+v.", pbkdfType)
+	}
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	headerInfo, err := device.DumpJSON()
+	testWrapper.AssertNoError(err)
+	kdf := headerInfo.Keyslots[0].KDF
+	if kdf.Type != CRYPT_KDF_PBKDF2 || kdf.Hash != "sha512" || kdf.Iterations != 1000 {
+		test.Errorf("Keyslot should use the PBKDF set on the device, got %+v.", kdf)
+	}
+
+	err = device.SetPBKDF(nil)
+	testWrapper.AssertNoError(err)
+
+	pbkdfType = device.PBKDF()
+	if pbkdfType == nil || pbkdfType.Type != DefaultPBKDF(LUKS2{}).Type {
+		test.Errorf("PBKDF should be reset to the LUKS2 default, got %+v.", pbkdfType)
+	}
+}
+
+func Test_LUKS2_SetPBKDF_Fails_If_PBKDF_Is_Invalid(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.SetPBKDF(&PbkdfType{Type: "invalid", Hash: "sha256", TimeMs: 2000})
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_DefaultPBKDF(test *testing.T) {
+	if !pbkdfTypeSupported() {
+		test.Skip("PBKDF and DefaultPBKDF require a libcryptsetup providing crypt_get_pbkdf_type and crypt_get_pbkdf_default.")
+	}
+
+	if pbkdfType := DefaultPBKDF(LUKS2{}); pbkdfType == nil || (pbkdfType.Type != CRYPT_KDF_ARGON2ID && pbkdfType.Type != CRYPT_KDF_ARGON2I) {
+		test.Errorf("Unexpected LUKS2 default PBKDF: %+v.", pbkdfType)
+	}
+
+	if pbkdfType := DefaultPBKDF(LUKS1{}); pbkdfType == nil || pbkdfType.Type != CRYPT_KDF_PBKDF2 {
+		test.Errorf("Unexpected LUKS1 default PBKDF: %+v.", pbkdfType)
+	}
+
+	if pbkdfType := DefaultPBKDF(Plain{}); pbkdfType != nil {
+		test.Errorf("Plain devices should have no default PBKDF, got %+v.", pbkdfType)
+	}
+}
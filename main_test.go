@@ -1,10 +1,14 @@
 package cryptsetup
 
 import (
+	"crypto/aes"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"os/exec"
@@ -12,6 +16,8 @@ import (
 )
 
 const DevicePath string = "testDevice"
+const HashDevicePath string = "testHashDevice"
+const HeaderDevicePath string = "testHeaderDevice"
 const DeviceName string = "testDeviceName"
 const PassKey string = "testPassKey"
 
@@ -39,6 +45,77 @@ func (testWrapper TestWrapper) AssertErrorCodeEquals(err error, expectedErrorCod
 	}
 }
 
+// skipIfNotSupported skips the test if 'err' reports that the installed libcryptsetup is too old for the function under test.
+func skipIfNotSupported(err error, test *testing.T) {
+	if cryptsetupError, ok := err.(*Error); ok && cryptsetupError.Code() == -95 {
+		test.Skipf("Not supported by the installed libcryptsetup: %s", err)
+	}
+}
+
+// pbkdf2 derives 'keyLength' bytes from 'password' and 'salt' using HMAC with 'newHash', as specified by RFC 8018.
+func pbkdf2(newHash func() hash.Hash, password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(newHash, password)
+	key := make([]byte, 0, keyLength)
+
+	for block := uint32(1); len(key) < keyLength; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+
+		for iteration := 1; iteration < iterations; iteration++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for index := range t {
+				t[index] ^= u[index]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:keyLength]
+}
+
+// encryptAESXTS encrypts 'data' in place as the first bytes of data unit 'unit', using AES-XTS.
+// The first half of 'key' is the data key, and the second half the tweak key.
+func encryptAESXTS(key, data []byte, unit uint64, test *testing.T) {
+	dataCipher, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		test.Fatal(err)
+	}
+	tweakCipher, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tweak := make([]byte, 16)
+	binary.LittleEndian.PutUint64(tweak, unit)
+	tweakCipher.Encrypt(tweak, tweak)
+
+	for offset := 0; offset < len(data); offset += 16 {
+		block := data[offset : offset+16]
+		for index := range block {
+			block[index] ^= tweak[index]
+		}
+		dataCipher.Encrypt(block, block)
+		for index := range block {
+			block[index] ^= tweak[index]
+		}
+
+		carry := tweak[15] >> 7
+		for index := 15; index > 0; index-- {
+			tweak[index] = tweak[index]<<1 | tweak[index-1]>>7
+		}
+		tweak[0] <<= 1
+		if carry != 0 {
+			tweak[0] ^= 0x87
+		}
+	}
+}
+
 func getFileMD5(filePath string, test *testing.T) string {
 	fileHandle, error := os.Open(filePath)
 	if error != nil {
@@ -66,6 +143,16 @@ func generateKey(length int, test *testing.T) string {
 	return string(bytes[:])
 }
 
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 func setup(devicePath string) {
 	exec.Command("/bin/dd", "if=/dev/zero", fmt.Sprintf("of=%s", devicePath), "bs=64M", "count=1").Run()
 }
@@ -85,7 +172,11 @@ func TestMain(m *testing.M) {
 	}
 
 	setup(DevicePath)
+	setup(HashDevicePath)
+	setup(HeaderDevicePath)
 	result := m.Run()
+	teardown(HeaderDevicePath)
+	teardown(HashDevicePath)
 	teardown(DevicePath)
 	os.Exit(result)
 }
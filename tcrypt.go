@@ -0,0 +1,97 @@
+package cryptsetup
+
+// #cgo pkg-config: libcryptsetup
+// #include <libcryptsetup.h>
+// #include <stdlib.h>
+import "C"
+import "unsafe"
+
+// TCRYPT is the struct used to manipulate TrueCrypt and VeraCrypt devices.
+// These devices can only be loaded, and once loaded they're activated using ActivateByVolumeKey() with an empty volume key.
+// Set CRYPT_TCRYPT_VERA_MODES in Flags to open VeraCrypt containers.
+type TCRYPT struct {
+	Passphrase   string
+	KeyFiles     []string
+	HashName     string
+	Cipher       string
+	Mode         string
+	KeySize      int
+	Flags        uint32
+	VeraCryptPIM uint32
+}
+
+// Name returns the TCRYPT device type name as a string.
+func (tcrypt TCRYPT) Name() string {
+	return C.CRYPT_TCRYPT
+}
+
+// Unmanaged is used to specialize TCRYPT.
+func (tcrypt TCRYPT) Unmanaged() (unsafe.Pointer, func()) {
+	deallocations := make([]func(), 0, 5+len(tcrypt.KeyFiles))
+	deallocate := func() {
+		for index := 0; index < len(deallocations); index++ {
+			deallocations[index]()
+		}
+	}
+
+	var cParams C.struct_crypt_params_tcrypt
+
+	cParams.passphrase = nil
+	if tcrypt.Passphrase != "" {
+		cParams.passphrase = C.CString(tcrypt.Passphrase)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.passphrase))
+		})
+	}
+	cParams.passphrase_size = C.size_t(len(tcrypt.Passphrase))
+
+	cParams.keyfiles = nil
+	if len(tcrypt.KeyFiles) > 0 {
+		cKeyFiles := (**C.char)(C.malloc(C.size_t(len(tcrypt.KeyFiles)) * C.size_t(unsafe.Sizeof(uintptr(0)))))
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cKeyFiles))
+		})
+
+		cKeyFilesSlice := (*[1 << 28]*C.char)(unsafe.Pointer(cKeyFiles))[:len(tcrypt.KeyFiles):len(tcrypt.KeyFiles)]
+		for index, keyFile := range tcrypt.KeyFiles {
+			cKeyFile := C.CString(keyFile)
+			cKeyFilesSlice[index] = cKeyFile
+			deallocations = append(deallocations, func() {
+				C.free(unsafe.Pointer(cKeyFile))
+			})
+		}
+
+		cParams.keyfiles = cKeyFiles
+	}
+	cParams.keyfiles_count = C.uint(len(tcrypt.KeyFiles))
+
+	cParams.hash_name = nil
+	if tcrypt.HashName != "" {
+		cParams.hash_name = C.CString(tcrypt.HashName)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.hash_name))
+		})
+	}
+
+	cParams.cipher = nil
+	if tcrypt.Cipher != "" {
+		cParams.cipher = C.CString(tcrypt.Cipher)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.cipher))
+		})
+	}
+
+	cParams.mode = nil
+	if tcrypt.Mode != "" {
+		cParams.mode = C.CString(tcrypt.Mode)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.mode))
+		})
+	}
+
+	cParams.key_size = C.size_t(tcrypt.KeySize)
+	cParams.flags = C.uint32_t(tcrypt.Flags)
+	cParams.veracrypt_pim = C.uint32_t(tcrypt.VeraCryptPIM)
+
+	return unsafe.Pointer(&cParams), deallocate
+}
@@ -0,0 +1,123 @@
+package cryptsetup
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+// createVeraCryptImage writes a VeraCrypt AES-XTS/SHA-512 volume header to 'devicePath'.
+func createVeraCryptImage(devicePath, passphrase string, pim uint32, test *testing.T) {
+	const dataOffset = 128 * 1024
+
+	deviceInfo, err := os.Stat(devicePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	header := make([]byte, 512)
+	if _, err := rand.Read(header[:64]); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := rand.Read(header[256:]); err != nil {
+		test.Fatal(err)
+	}
+
+	copy(header[64:], "VERA")
+	binary.BigEndian.PutUint16(header[68:], 5)
+	binary.BigEndian.PutUint16(header[70:], 0x010b)
+	binary.BigEndian.PutUint32(header[72:], crc32.ChecksumIEEE(header[256:512]))
+	binary.BigEndian.PutUint64(header[100:], uint64(deviceInfo.Size()-2*dataOffset))
+	binary.BigEndian.PutUint64(header[108:], dataOffset)
+	binary.BigEndian.PutUint64(header[116:], uint64(deviceInfo.Size()-2*dataOffset))
+	binary.BigEndian.PutUint32(header[128:], 512)
+	binary.BigEndian.PutUint32(header[252:], crc32.ChecksumIEEE(header[64:252]))
+
+	headerKey := pbkdf2(sha512.New, []byte(passphrase), header[:64], 15000+int(pim)*1000, 64)
+	encryptAESXTS(headerKey, header[64:], 0, test)
+
+	device, err := os.OpenFile(devicePath, os.O_WRONLY, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer device.Close()
+
+	if _, err := device.WriteAt(header, 0); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func Test_TCRYPT_Load_ActivateByVolumeKey_Deactivate(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	createVeraCryptImage(DevicePath, "testPassphrase", 1, test)
+
+	tcrypt := TCRYPT{
+		Passphrase:   "testPassphrase",
+		HashName:     "sha512",
+		Flags:        CRYPT_TCRYPT_VERA_MODES,
+		VeraCryptPIM: 1,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(tcrypt)
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "TCRYPT" {
+		test.Error("Expected type: TCRYPT.")
+	}
+
+	err = device.ActivateByVolumeKey(DeviceName, "", 0, CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertNoError(err)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_TCRYPT_Load_Fails_If_Passphrase_Is_Wrong(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	createVeraCryptImage(DevicePath, "testPassphrase", 1, test)
+
+	tcrypt := TCRYPT{
+		Passphrase:   "wrongPassphrase",
+		HashName:     "sha512",
+		Flags:        CRYPT_TCRYPT_VERA_MODES,
+		VeraCryptPIM: 1,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(tcrypt)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -1)
+}
+
+func Test_TCRYPT_Load_Fails_If_KeyFile_Is_Missing(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	createVeraCryptImage(DevicePath, "testPassphrase", 1, test)
+
+	tcrypt := TCRYPT{
+		Passphrase:   "testPassphrase",
+		KeyFiles:     []string{"nonExistingKeyFile"},
+		HashName:     "sha512",
+		Flags:        CRYPT_TCRYPT_VERA_MODES,
+		VeraCryptPIM: 1,
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Load(tcrypt)
+	testWrapper.AssertError(err)
+}
@@ -0,0 +1,386 @@
+package cryptsetup
+
+// #cgo pkg-config: libcryptsetup
+// #include <libcryptsetup.h>
+// #include <stdlib.h>
+import "C"
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"math/bits"
+	"os"
+	"regexp"
+	"strconv"
+	"unsafe"
+)
+
+// Verity is the struct used to manipulate dm-verity devices.
+// The crypt device itself must be initialised using the hash device's path.
+// Set CRYPT_VERITY_CREATE_HASH in Flags for Format() to build the hash tree.
+// Forward error correction is enabled by setting FECDevice and FECRoots,
+// both when formatting and when loading the device prior to activation.
+type Verity struct {
+	HashName       string
+	DataDevice     string
+	HashDevice     string
+	FECDevice      string
+	Salt           []byte
+	SaltSize       uint32
+	HashType       uint32
+	DataBlockSize  uint32
+	HashBlockSize  uint32
+	DataSize       uint64
+	HashAreaOffset uint64
+	FECAreaOffset  uint64
+	FECRoots       uint32
+	Flags          uint32
+}
+
+// Name returns the VERITY device type name as a string.
+func (verity Verity) Name() string {
+	return C.CRYPT_VERITY
+}
+
+// Unmanaged is used to specialize Verity.
+// If Salt is empty, SaltSize bytes of random salt are generated when formatting.
+func (verity Verity) Unmanaged() (unsafe.Pointer, func()) {
+	deallocations := make([]func(), 0, 6)
+	deallocate := func() {
+		for index := 0; index < len(deallocations); index++ {
+			deallocations[index]()
+		}
+	}
+
+	var cParams C.struct_crypt_params_verity
+
+	cParams.hash_name = nil
+	if verity.HashName != "" {
+		cParams.hash_name = C.CString(verity.HashName)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.hash_name))
+		})
+	}
+
+	cParams.data_device = nil
+	if verity.DataDevice != "" {
+		cParams.data_device = C.CString(verity.DataDevice)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.data_device))
+		})
+	}
+
+	cParams.hash_device = nil
+	if verity.HashDevice != "" {
+		cParams.hash_device = C.CString(verity.HashDevice)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.hash_device))
+		})
+	}
+
+	cParams.fec_device = nil
+	if verity.FECDevice != "" {
+		cParams.fec_device = C.CString(verity.FECDevice)
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.fec_device))
+		})
+	}
+
+	cParams.salt = nil
+	cParams.salt_size = C.uint32_t(verity.SaltSize)
+	if len(verity.Salt) > 0 {
+		cParams.salt = (*C.char)(C.CBytes(verity.Salt))
+		cParams.salt_size = C.uint32_t(len(verity.Salt))
+		deallocations = append(deallocations, func() {
+			C.free(unsafe.Pointer(cParams.salt))
+		})
+	}
+
+	cParams.hash_type = C.uint32_t(verity.HashType)
+	cParams.data_block_size = C.uint32_t(verity.DataBlockSize)
+	cParams.hash_block_size = C.uint32_t(verity.HashBlockSize)
+	cParams.data_size = C.uint64_t(verity.DataSize)
+	cParams.hash_area_offset = C.uint64_t(verity.HashAreaOffset)
+	cParams.fec_area_offset = C.uint64_t(verity.FECAreaOffset)
+	cParams.fec_roots = C.uint32_t(verity.FECRoots)
+	cParams.flags = C.uint32_t(verity.Flags)
+
+	return unsafe.Pointer(&cParams), deallocate
+}
+
+// VerityArea identifies the part of a Verity device that failed verification.
+type VerityArea int
+
+const (
+	// VerityAreaData means a data block did not match its digest in the hash tree.
+	VerityAreaData VerityArea = iota
+	// VerityAreaHash means a hash block did not match its digest in the next level of the hash tree.
+	VerityAreaHash
+	// VerityAreaRootHash means the hash tree is consistent, but does not match the provided root hash.
+	VerityAreaRootHash
+	// VerityAreaHashSpare means the padding following the digests of a hash block is not zeroed.
+	VerityAreaHashSpare
+	// VerityAreaUnknown means a block failed verification, but it can't be told whether it's a data block or a hash block.
+	VerityAreaUnknown
+)
+
+// VerityVerificationError is returned by VerifyVerity when a Verity device fails userspace verification.
+// Position is the byte offset reported by libcryptsetup, in the data device for VerityAreaData,
+// and in the hash device for VerityAreaHash and VerityAreaHashSpare.
+// Block is the matching block number, using the data block size for VerityAreaData, and the hash block size otherwise.
+// Level is the level of the hash tree holding the hash block, 0 being the level holding the digests of data blocks.
+// Block and Level are only set for the areas they apply to.
+type VerityVerificationError struct {
+	Err      *Error
+	Area     VerityArea
+	Position uint64
+	Block    uint64
+	Level    int
+}
+
+func (e *VerityVerificationError) Error() string {
+	switch e.Area {
+	case VerityAreaData:
+		return fmt.Sprintf("%s Verification of data block %d (position %d) failed.", e.Err.Error(), e.Block, e.Position)
+	case VerityAreaHash:
+		return fmt.Sprintf("%s Verification of hash block %d at level %d (position %d) failed.", e.Err.Error(), e.Block, e.Level, e.Position)
+	case VerityAreaHashSpare:
+		return fmt.Sprintf("%s Spare area of hash block %d at level %d (position %d) is not zeroed.", e.Err.Error(), e.Block, e.Level, e.Position)
+	case VerityAreaUnknown:
+		return fmt.Sprintf("%s Verification failed at position %d.", e.Err.Error(), e.Position)
+	default:
+		return fmt.Sprintf("%s Verification of root hash failed.", e.Err.Error())
+	}
+}
+
+// Code returns the error code returned by libcryptsetup.
+func (e *VerityVerificationError) Code() int {
+	return e.Err.Code()
+}
+
+// Unwrap returns the underlying libcryptsetup error.
+func (e *VerityVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// VerityVerification is the outcome of a successful VerifyVerity.
+// FECRepairableErrors is the number of errors found during verification, which can all be repaired using FEC.
+type VerityVerification struct {
+	FECRepairableErrors uint32
+}
+
+var verityFECRepairablePattern = regexp.MustCompile(`^Found (\d+) repairable errors with FEC device\.`)
+
+// newVerityVerification builds a VerityVerification out of the messages libcryptsetup logged during a successful verification.
+func newVerityVerification(entries []logEntry) VerityVerification {
+	for _, entry := range entries {
+		if match := verityFECRepairablePattern.FindStringSubmatch(entry.message); match != nil {
+			errors, _ := strconv.ParseUint(match[1], 10, 32)
+			return VerityVerification{FECRepairableErrors: uint32(errors)}
+		}
+	}
+
+	return VerityVerification{}
+}
+
+var verityBlockFailurePattern = regexp.MustCompile(`^Verification failed at position (\d+)\.`)
+var veritySpareFailurePattern = regexp.MustCompile(`^Spare area is not zeroed at position (\d+)\.`)
+var verityRootHashFailurePattern = regexp.MustCompile(`^Verification of root hash failed\.`)
+
+// verityHashes holds the hash algorithms a Verity data block digest can be computed with in Go.
+var verityHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// veritySuperblockSize is the size of the on-disk Verity header.
+const veritySuperblockSize = 512
+
+// verityTree describes where libcryptsetup stores the levels of a Verity hash tree in the hash device.
+// Level 0 holds the digests of the data blocks, and the last level is covered by the root hash.
+// levelBlocks holds the first block of each level, and levelSizes their sizes, both in hash blocks.
+type verityTree struct {
+	verity         Verity
+	digestSize     uint64
+	digestSizeFull uint64
+	hashesPerBlock uint64
+	levelBlocks    []uint64
+	levelSizes     []uint64
+}
+
+// newVerityTree lays out the hash tree of 'verity' the same way libcryptsetup does.
+// Returns false if the parameters don't describe a valid hash tree.
+func newVerityTree(verity Verity, digestSize int) (verityTree, bool) {
+	if digestSize <= 0 || verity.HashBlockSize == 0 || verity.DataBlockSize == 0 || verity.DataSize == 0 {
+		return verityTree{}, false
+	}
+
+	tree := verityTree{verity: verity, digestSize: uint64(digestSize), digestSizeFull: uint64(digestSize)}
+	if verity.HashType != 0 {
+		tree.digestSizeFull = 1 << bits.Len64(uint64(digestSize)-1)
+	}
+
+	hashesPerBlockBits := bits.Len64(uint64(verity.HashBlockSize)/tree.digestSize) - 1
+	if hashesPerBlockBits <= 0 {
+		return verityTree{}, false
+	}
+	tree.hashesPerBlock = 1 << hashesPerBlockBits
+
+	levels := 0
+	for hashesPerBlockBits*levels < 64 && (verity.DataSize-1)>>(hashesPerBlockBits*levels) != 0 {
+		levels++
+	}
+
+	tree.levelBlocks = make([]uint64, levels)
+	tree.levelSizes = make([]uint64, levels)
+	// With an on-disk header, the hash tree starts at the first hash block following the superblock.
+	position := verity.HashAreaOffset
+	if verity.Flags&CRYPT_VERITY_NO_HEADER == 0 {
+		position += veritySuperblockSize + uint64(verity.HashBlockSize) - 1
+	}
+	position /= uint64(verity.HashBlockSize)
+	for level := levels - 1; level >= 0; level-- {
+		shift := (level + 1) * hashesPerBlockBits
+		if shift > 63 {
+			return verityTree{}, false
+		}
+
+		tree.levelBlocks[level] = position
+		tree.levelSizes[level] = (verity.DataSize + (1 << shift) - 1) >> shift
+		position += tree.levelSizes[level]
+	}
+
+	return tree, true
+}
+
+// hashLevel returns the level of the hash block at 'position' in the hash device, or false if it's outside the hash tree.
+func (tree verityTree) hashLevel(position uint64) (int, bool) {
+	block := position / uint64(tree.verity.HashBlockSize)
+	for level := range tree.levelBlocks {
+		if block >= tree.levelBlocks[level] && block < tree.levelBlocks[level]+tree.levelSizes[level] {
+			return level, true
+		}
+	}
+
+	return 0, false
+}
+
+// dataBlockCorrupted checks whether the data block at 'position' in the data device still matches its digest.
+// Returns an error if it can't be checked, e.g. if Go doesn't implement the hash algorithm.
+func (tree verityTree) dataBlockCorrupted(position uint64) (bool, error) {
+	newHash, found := verityHashes[tree.verity.HashName]
+	if !found {
+		return false, fmt.Errorf("unsupported Verity hash algorithm: %s", tree.verity.HashName)
+	}
+
+	block := position / uint64(tree.verity.DataBlockSize)
+	data, err := readAt(tree.verity.DataDevice, int64(position), int(tree.verity.DataBlockSize))
+	if err != nil {
+		return false, err
+	}
+
+	digestPosition := (tree.levelBlocks[0]+block/tree.hashesPerBlock)*uint64(tree.verity.HashBlockSize) + block%tree.hashesPerBlock*tree.digestSizeFull
+	digest, err := readAt(tree.verity.HashDevice, int64(digestPosition), int(tree.digestSize))
+	if err != nil {
+		return false, err
+	}
+
+	dataHash := newHash()
+	if tree.verity.HashType != 0 {
+		dataHash.Write(tree.verity.Salt)
+	}
+	dataHash.Write(data)
+	if tree.verity.HashType == 0 {
+		dataHash.Write(tree.verity.Salt)
+	}
+
+	return !bytes.Equal(dataHash.Sum(nil), digest), nil
+}
+
+// readAt reads 'size' bytes at 'offset' in the file at 'path'.
+func readAt(path string, offset int64, size int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buffer := make([]byte, size)
+	if _, err := file.ReadAt(buffer, offset); err != nil {
+		return nil, err
+	}
+
+	return buffer, nil
+}
+
+// newVerityVerificationError builds a VerityVerificationError out of the messages libcryptsetup logged during verification.
+// libcryptsetup reports the same message for every level of the hash tree, with a position in the data device for data blocks,
+// and in the hash device for hash blocks, so the hash tree of 'verity' is laid out to tell them apart.
+// If the position could be either, the data block is checked against its digest.
+// Returns 'err' itself if the messages don't describe a verification failure.
+func newVerityVerificationError(err *Error, entries []logEntry, verity Verity, digestSize int) error {
+	tree, validTree := newVerityTree(verity, digestSize)
+
+	for _, entry := range entries {
+		if entry.level != CRYPT_LOG_ERROR {
+			continue
+		}
+
+		if match := verityBlockFailurePattern.FindStringSubmatch(entry.message); match != nil {
+			position, _ := strconv.ParseUint(match[1], 10, 64)
+			verificationError := &VerityVerificationError{Err: err, Area: VerityAreaUnknown, Position: position}
+			if !validTree {
+				return verificationError
+			}
+
+			dataBlock := position/uint64(verity.DataBlockSize) < verity.DataSize
+			level, hashBlock := tree.hashLevel(position)
+			// The last level is verified against the root hash, so it's never reported here.
+			hashBlock = hashBlock && level < len(tree.levelBlocks)-1
+
+			if dataBlock && hashBlock {
+				if verity.DataDevice == verity.HashDevice {
+					dataBlock = false
+				} else if corrupted, checkErr := tree.dataBlockCorrupted(position); checkErr != nil {
+					return verificationError
+				} else {
+					dataBlock, hashBlock = corrupted, !corrupted
+				}
+			}
+
+			if dataBlock {
+				verificationError.Area = VerityAreaData
+				verificationError.Block = position / uint64(verity.DataBlockSize)
+			} else if hashBlock {
+				verificationError.Area = VerityAreaHash
+				verificationError.Block = position / uint64(verity.HashBlockSize)
+				verificationError.Level = level
+			}
+
+			return verificationError
+		}
+
+		if match := veritySpareFailurePattern.FindStringSubmatch(entry.message); match != nil {
+			position, _ := strconv.ParseUint(match[1], 10, 64)
+			verificationError := &VerityVerificationError{Err: err, Area: VerityAreaHashSpare, Position: position}
+			if validTree {
+				verificationError.Block = position / uint64(verity.HashBlockSize)
+				verificationError.Level, _ = tree.hashLevel(position)
+			}
+
+			return verificationError
+		}
+
+		if verityRootHashFailurePattern.MatchString(entry.message) {
+			return &VerityVerificationError{Err: err, Area: VerityAreaRootHash}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,627 @@
+package cryptsetup
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func Test_Verity_Format(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+
+	hashBeforeFormat := getFileMD5(HashDevicePath, test)
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	hashAfterFormat := getFileMD5(HashDevicePath, test)
+
+	if hashBeforeFormat == hashAfterFormat {
+		test.Error("Unsuccessful call to Format() when using Verity parameters.")
+	}
+
+	if device.Type() != "VERITY" {
+		test.Error("Expected type: VERITY.")
+	}
+
+	device.Free()
+}
+
+func Test_Verity_Format_Fails_Without_Data_Device(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+
+	device.Free()
+}
+
+func Test_Verity_Load(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		Salt:          []byte("0123456789abcdef"),
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Load(Verity{DataDevice: DevicePath})
+	testWrapper.AssertNoError(err)
+
+	if device.Type() != "VERITY" {
+		test.Error("Expected type: VERITY.")
+	}
+
+	device.Free()
+}
+
+func Test_Verity_ActivateByRootHash_Deactivate(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByRootHash(DeviceName, rootHash, CRYPT_ACTIVATE_READONLY|CRYPT_ACTIVATE_IGNORE_ZERO_BLOCKS)
+	testWrapper.AssertNoError(err)
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_Verity_ActivateByRootHash_Fails_If_Device_Has_No_Type(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.ActivateByRootHash(DeviceName, []byte("rootHash"), CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_Verity_ActivateBySignedRootHash_Fails_If_Signature_Is_Invalid(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateBySignedRootHash(DeviceName, rootHash, []byte("invalidSignature"), CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertError(err)
+}
+
+func Test_Verity_Format_Load_ActivateByRootHash_Using_FEC(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		FECDevice:     HashDevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		FECAreaOffset: 32 * 1024 * 1024,
+		FECRoots:      2,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, _, err := device.VolumeKeyGet(CRYPT_ANY_SLOT, "")
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Load(Verity{DataDevice: DevicePath, FECDevice: HashDevicePath, FECAreaOffset: 32 * 1024 * 1024, FECRoots: 2})
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByRootHash(DeviceName, rootHash, CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertNoError(err)
+
+	activeDevice, err := device.GetActiveDevice(DeviceName)
+	testWrapper.AssertNoError(err)
+
+	if activeDevice.Flags&CRYPT_ACTIVATE_CORRUPTED != 0 {
+		test.Error("Device should not have been reported as corrupted.")
+	}
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_Verity_VerifyVerity(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	_, err = device.VerifyVerity(rootHash)
+	testWrapper.AssertNoError(err)
+
+	verity, err = device.GetVerityInfo()
+	testWrapper.AssertNoError(err)
+
+	if verity.Flags&CRYPT_VERITY_CHECK_HASH != 0 {
+		test.Error("Device should have been loaded again with its original flags.")
+	}
+}
+
+func Test_Verity_VerifyVerity_Fails_If_Root_Hash_Is_Wrong(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	rootHash[0] ^= 0xff
+
+	_, err = device.VerifyVerity(rootHash)
+	testWrapper.AssertError(err)
+
+	var verificationError *VerityVerificationError
+	if !errors.As(err, &verificationError) {
+		test.Fatalf("Expected a VerityVerificationError, got: %v", err)
+	}
+
+	if verificationError.Area != VerityAreaRootHash {
+		test.Errorf("Expected the root hash to fail verification, got area: %d", verificationError.Area)
+	}
+
+	if verificationError.Code() != -14 {
+		test.Errorf("Error code should be '-14', but '%d' was returned instead.", verificationError.Code())
+	}
+}
+
+func Test_Verity_VerifyVerity_Without_Header(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		Salt:          []byte("0123456789abcdef"),
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		DataSize:      64 * 1024 * 1024 / 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH | CRYPT_VERITY_NO_HEADER,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	verity.Flags = CRYPT_VERITY_NO_HEADER
+
+	device, err = Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	_, err = device.VerifyVerity(rootHash)
+	testWrapper.AssertNoError(err)
+
+	dataDevice, err := os.OpenFile(DevicePath, os.O_RDWR, 0)
+	testWrapper.AssertNoError(err)
+	defer dataDevice.Close()
+
+	_, err = dataDevice.WriteAt([]byte("corruption"), 7*4096+100)
+	testWrapper.AssertNoError(err)
+	defer dataDevice.WriteAt(make([]byte, len("corruption")), 7*4096+100)
+
+	_, err = device.VerifyVerity(rootHash)
+	testWrapper.AssertError(err)
+
+	var verificationError *VerityVerificationError
+	if !errors.As(err, &verificationError) {
+		test.Fatalf("Expected a VerityVerificationError, got: %v", err)
+	}
+
+	if verificationError.Area != VerityAreaData || verificationError.Block != 7 {
+		test.Errorf("Expected data block 7 to fail verification, got area %d, block %d", verificationError.Area, verificationError.Block)
+	}
+
+	info, err := device.GetVerityInfo()
+	testWrapper.AssertNoError(err)
+
+	if info.Flags != CRYPT_VERITY_NO_HEADER {
+		test.Errorf("Flags should have been restored to CRYPT_VERITY_NO_HEADER, got: %d", info.Flags)
+	}
+}
+
+func Test_Verity_VerifyVerity_Reports_FEC_Repairable_Errors(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		FECDevice:     HashDevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		FECAreaOffset: 32 * 1024 * 1024,
+		FECRoots:      2,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	verification, err := device.VerifyVerity(rootHash)
+	testWrapper.AssertNoError(err)
+
+	if verification.FECRepairableErrors != 0 {
+		test.Errorf("No errors should have been found, got: %d", verification.FECRepairableErrors)
+	}
+
+	dataDevice, err := os.OpenFile(DevicePath, os.O_RDWR, 0)
+	testWrapper.AssertNoError(err)
+	defer dataDevice.Close()
+
+	_, err = dataDevice.WriteAt([]byte{0xff}, 7*4096+100)
+	testWrapper.AssertNoError(err)
+	defer dataDevice.WriteAt([]byte{0}, 7*4096+100)
+
+	verification, err = device.VerifyVerity(rootHash)
+	testWrapper.AssertNoError(err)
+
+	if verification.FECRepairableErrors != 1 {
+		test.Errorf("1 repairable error should have been found, got: %d", verification.FECRepairableErrors)
+	}
+}
+
+func Test_Verity_VerifyVerity_Reports_Corrupted_Data_Block(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	dataDevice, err := os.OpenFile(DevicePath, os.O_RDWR, 0)
+	testWrapper.AssertNoError(err)
+	defer dataDevice.Close()
+
+	_, err = dataDevice.WriteAt([]byte("corruption"), 7*4096+100)
+	testWrapper.AssertNoError(err)
+	defer dataDevice.WriteAt(make([]byte, len("corruption")), 7*4096+100)
+
+	_, err = device.VerifyVerity(rootHash)
+	testWrapper.AssertError(err)
+
+	var verificationError *VerityVerificationError
+	if !errors.As(err, &verificationError) {
+		test.Fatalf("Expected a VerityVerificationError, got: %v", err)
+	}
+
+	if verificationError.Area != VerityAreaData {
+		test.Errorf("Expected the data area to fail verification, got area: %d", verificationError.Area)
+	}
+
+	if verificationError.Block != 7 || verificationError.Position != 7*4096 {
+		test.Errorf("Expected data block 7 at position %d, got block %d at position %d", 7*4096, verificationError.Block, verificationError.Position)
+	}
+}
+
+func Test_Verity_Load_GetVerityInfo(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	salt := []byte("0123456789abcdef")
+	verity := Verity{
+		HashName:      "sha512",
+		DataDevice:    DevicePath,
+		Salt:          salt,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 1024,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	if len(rootHash) != 512/8 {
+		test.Errorf("Invalid root hash length: %d", len(rootHash))
+	}
+
+	device.Free()
+
+	device, err = Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Load(Verity{DataDevice: DevicePath})
+	testWrapper.AssertNoError(err)
+
+	loadedVerity, err := device.GetVerityInfo()
+	testWrapper.AssertNoError(err)
+
+	if loadedVerity.HashName != "sha512" {
+		test.Errorf("Expected hash name 'sha512', got '%s'.", loadedVerity.HashName)
+	}
+	if loadedVerity.DataDevice != DevicePath || loadedVerity.HashDevice != HashDevicePath {
+		test.Errorf("Unexpected devices: data '%s', hash '%s'.", loadedVerity.DataDevice, loadedVerity.HashDevice)
+	}
+	if string(loadedVerity.Salt) != string(salt) || loadedVerity.SaltSize != uint32(len(salt)) {
+		test.Errorf("Unexpected salt: %x", loadedVerity.Salt)
+	}
+	if loadedVerity.DataBlockSize != 4096 || loadedVerity.HashBlockSize != 1024 {
+		test.Errorf("Unexpected block sizes: data %d, hash %d.", loadedVerity.DataBlockSize, loadedVerity.HashBlockSize)
+	}
+	if loadedVerity.DataSize != 64*1024*1024/4096 {
+		test.Errorf("Unexpected data size: %d", loadedVerity.DataSize)
+	}
+
+	_, err = device.GetVerityRootHash()
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_Verity_ActivateByRootHash_InitByName_GetVerityRootHash(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByRootHash(DeviceName, rootHash, CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertNoError(err)
+	device.Free()
+
+	device, err = InitByName(DeviceName)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	activeRootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	if string(activeRootHash) != string(rootHash) {
+		test.Errorf("Root hash of the active device differs: got %x, expected %x", activeRootHash, rootHash)
+	}
+
+	err = device.Deactivate(DeviceName)
+	testWrapper.AssertNoError(err)
+	device.Free()
+}
+
+func Test_Verity_GetVerityInfo_Fails_If_Device_Has_No_Type(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	_, err = device.GetVerityInfo()
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_Verity_VerifyVerity_Reports_Corrupted_Hash_Block(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	verity := Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		SaltSize:      32,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}
+
+	device, err := Init(HashDevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(verity, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, err := device.GetVerityRootHash()
+	testWrapper.AssertNoError(err)
+
+	hashDevice, err := os.OpenFile(HashDevicePath, os.O_RDWR, 0)
+	testWrapper.AssertNoError(err)
+	defer hashDevice.Close()
+
+	// The top level of the hash tree is the first block following the header,
+	// and its sixth digest covers the sixth block of level 0, which is hash block 7.
+	_, err = hashDevice.WriteAt([]byte("corruption"), 4096+5*32)
+	testWrapper.AssertNoError(err)
+
+	_, err = device.VerifyVerity(rootHash)
+	testWrapper.AssertError(err)
+
+	var verificationError *VerityVerificationError
+	if !errors.As(err, &verificationError) {
+		test.Fatalf("Expected a VerityVerificationError, got: %v", err)
+	}
+
+	if verificationError.Area != VerityAreaHash {
+		test.Errorf("Expected the hash area to fail verification, got area: %d", verificationError.Area)
+	}
+
+	if verificationError.Level != 0 || verificationError.Block != 7 || verificationError.Position != 7*4096 {
+		test.Errorf("Expected hash block 7 of level 0 at position %d, got block %d of level %d at position %d", 7*4096, verificationError.Block, verificationError.Level, verificationError.Position)
+	}
+}
+
+func Test_Verity_VerityVerificationError_Is_Unknown_If_Position_Is_Ambiguous(test *testing.T) {
+	verity := Verity{
+		HashName:      "whirlpool",
+		DataDevice:    DevicePath,
+		HashDevice:    HashDevicePath,
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		DataSize:      64 * 1024 * 1024 / 4096,
+	}
+	entries := []logEntry{{level: CRYPT_LOG_ERROR, message: "Verification failed at position 28672.\n"}}
+
+	err := newVerityVerificationError(&Error{functionName: "crypt_activate_by_volume_key", code: -1}, entries, verity, 64)
+
+	var verificationError *VerityVerificationError
+	if !errors.As(err, &verificationError) {
+		test.Fatalf("Expected a VerityVerificationError, got: %v", err)
+	}
+
+	if verificationError.Area != VerityAreaUnknown || verificationError.Position != 7*4096 || verificationError.Block != 0 {
+		test.Errorf("Expected an unknown area at position %d, got area %d, block %d at position %d", 7*4096, verificationError.Area, verificationError.Block, verificationError.Position)
+	}
+}